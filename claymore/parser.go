@@ -0,0 +1,226 @@
+// Package claymore reads the stats replies of Claymore's miner API and of
+// miners answering like it.
+package claymore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reasons a miner reply is rejected, used as the reason label of
+// claymore_parse_failures_total.
+const (
+	ReasonNotJSON   = "not_json"
+	ReasonShort     = "short_reply"
+	ReasonTotals    = "bad_totals"
+	ReasonGPUCount  = "gpu_count_mismatch"
+	ReasonBadNumber = "bad_number"
+)
+
+// Protocol levels of a reply, told apart by its number of fields. Older
+// miners send fewer.
+const (
+	// ProtoMinimal has the totals and GPU hashrates only, from miners
+	// predating dual mining and temperature reporting.
+	ProtoMinimal = "minimal"
+	// ProtoLegacy adds the secondary coin, temperatures and fans, and
+	// from 8 fields the pool, but lacks result[8].
+	ProtoLegacy = "legacy"
+	// ProtoGetstat1 is the full miner_getstat1 reply.
+	ProtoGetstat1 = "getstat1"
+	// ProtoGetstat2 adds per-GPU share counts and, from 16 fields, the
+	// GPUs' PCI buses.
+	ProtoGetstat2 = "getstat2"
+)
+
+// minReplyFields is the fewest fields a usable reply has: version, uptime,
+// totals and GPU hashrates.
+const minReplyFields = 4
+
+// replyProtocol returns the protocol level of a reply with n fields.
+func replyProtocol(n int) string {
+	switch {
+	case n > 10:
+		return ProtoGetstat2
+	case n > 8:
+		return ProtoGetstat1
+	case n > 6:
+		return ProtoLegacy
+	}
+	return ProtoMinimal
+}
+
+// ParseError is returned by ParseReply for replies it can't use.
+type ParseError struct {
+	Reason string
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Msg)
+}
+
+func parseErrorf(reason, format string, a ...interface{}) *ParseError {
+	return &ParseError{Reason: reason, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Numeric accepts numbers and the "off" Claymore prints for disabled GPUs.
+func Numeric(v string) bool {
+	if v == "off" {
+		return true
+	}
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+func checkNumeric(field string, values ...string) error {
+	for _, v := range values {
+		if !Numeric(v) {
+			return parseErrorf(ReasonBadNumber, "%s: %q is not a number", field, v)
+		}
+	}
+	return nil
+}
+
+// At returns s[i], or "" if s is too short.
+func At(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
+}
+
+// ParseReply turns a miner_getstat1/miner_getstat2 result into stats.
+// Structural problems (not a string array, missing fields, short totals)
+// are always errors. Fields a reply's protocol level doesn't have are left
+// empty. In strict mode the per-GPU lists the reply has must also agree in
+// length and every value must be numeric; otherwise missing GPU values are
+// left empty and bad numbers are exported as 0.
+func ParseReply(reply *json.RawMessage, strict bool) (*Stats, error) {
+	var result []string
+
+	if reply == nil {
+		return nil, parseErrorf(ReasonNotJSON, "empty reply")
+	}
+	if err := json.Unmarshal(*reply, &result); err != nil {
+		return nil, parseErrorf(ReasonNotJSON, "%v", err)
+	}
+
+	// result[1] contains uptime of the miner
+	// result[2] contains totals TotalHashRate;SharesFound;SharesRejected
+	// result[3] contais  per-GPU hashrate
+	// result[6] contains temperature;fan speed pairs of every GPU
+	// result[7] contains the pool, or both pools when dual mining
+	if len(result) < minReplyFields {
+		return nil, parseErrorf(ReasonShort, "%d fields, need at least %d", len(result), minReplyFields)
+	}
+	protocol := replyProtocol(len(result))
+
+	totals := strings.Split(result[2], ";")
+	if len(totals) < 3 {
+		return nil, parseErrorf(ReasonTotals, "%q", result[2])
+	}
+
+	hashrate := strings.Split(result[3], ";")
+
+	// result[4] contains the secondary coin's totals when dual mining
+	secondary := strings.Split(At(result, 4), ";")
+
+	// result[5] contains per-GPU secondary hashrate, "off" when not dual
+	// mining
+	secondaryHashrate := strings.Split(At(result, 5), ";")
+
+	var temps []string
+	var fans []string
+	if len(At(result, 6)) != 0 {
+		pairs := strings.Split(result[6], ";")
+		temps = make([]string, 0, (len(pairs)+1)/2)
+		fans = make([]string, 0, len(pairs)/2)
+		for i, v := range pairs {
+			if i%2 == 0 {
+				temps = append(temps, v)
+			} else {
+				fans = append(fans, v)
+			}
+		}
+	}
+
+	// miner_getstat2 adds per-GPU ETH accepted (result[9]) and rejected
+	// (result[10]) share counts.
+	var accepted, rejected, buses []string
+	if len(result) > 10 {
+		accepted = strings.Split(result[9], ";")
+		rejected = strings.Split(result[10], ";")
+	}
+	// result[15] contains the PCI bus of every GPU
+	if len(result) > 15 {
+		buses = strings.Split(result[15], ";")
+	}
+
+	if strict {
+		if protocol != ProtoMinimal && (len(temps) != len(hashrate) || len(fans) != len(hashrate)) {
+			return nil, parseErrorf(ReasonGPUCount, "%d hashrates but %d temperatures and %d fans",
+				len(hashrate), len(temps), len(fans))
+		}
+		if accepted != nil && (len(accepted) != len(hashrate) || len(rejected) != len(hashrate)) {
+			return nil, parseErrorf(ReasonGPUCount, "%d hashrates but %d accepted and %d rejected share counts",
+				len(hashrate), len(accepted), len(rejected))
+		}
+
+		checks := []struct {
+			field  string
+			values []string
+		}{
+			{"uptime", result[1:2]},
+			{"totals", totals[:3]},
+			{"hashrate", hashrate},
+			{"temperature", temps},
+			{"fan speed", fans},
+			{"accepted shares", accepted},
+			{"rejected shares", rejected},
+		}
+		for _, c := range checks {
+			if err := checkNumeric(c.field, c.values...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	GPUs := make([]GPUInfo, len(hashrate))
+	for i := range GPUs {
+		GPUs[i].FanSpeed = At(fans, i)
+		GPUs[i].Temp = At(temps, i)
+		GPUs[i].HashRate = hashrate[i]
+		GPUs[i].Name = "GPU" + strconv.Itoa(i)
+		GPUs[i].Enabled = hashrate[i] != "off"
+		if i < len(accepted) && i < len(rejected) {
+			GPUs[i].Accepted = accepted[i]
+			GPUs[i].Rejected = rejected[i]
+		}
+		GPUs[i].Bus = At(buses, i)
+		GPUs[i].SecondaryHashRate = At(secondaryHashrate, i)
+	}
+
+	// result[7] holds both pools separated by ';' when dual mining.
+	pools := strings.SplitN(At(result, 7), ";", 2)
+
+	stats := &Stats{
+		Version:   result[0],
+		Uptime:    result[1],
+		TotalRate: totals[0],
+		EthFound:  totals[1],
+		EthReject: totals[2],
+		Pool:      strings.TrimSpace(pools[0]),
+		GPUs:      GPUs,
+		Protocol:  protocol,
+
+		SecondaryRate:   At(secondary, 0),
+		SecondaryFound:  At(secondary, 1),
+		SecondaryReject: At(secondary, 2),
+		SecondaryPool:   strings.TrimSpace(At(pools, 1)),
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,176 @@
+package claymore
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/replies/*.golden")
+
+func readReply(t testing.TB, path string) *json.RawMessage {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := json.RawMessage(data)
+	return &reply
+}
+
+type goldenResult struct {
+	Lenient       *Stats
+	LenientError  string
+	StrictError   string
+	StrictMatches bool
+}
+
+// TestParseReplyGolden parses every reply in testdata/replies in both modes
+// and compares the outcome to the matching .golden file. Run with -update
+// after adding a sample to record its output.
+func TestParseReplyGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/replies/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			reply := readReply(t, file)
+
+			var res goldenResult
+			lenient, err := ParseReply(reply, false)
+			res.Lenient = lenient
+			if err != nil {
+				res.LenientError = err.Error()
+			}
+			strict, err := ParseReply(reply, true)
+			if err != nil {
+				res.StrictError = err.Error()
+			}
+			if lenient != nil && strict != nil {
+				a, _ := json.Marshal(lenient)
+				b, _ := json.Marshal(strict)
+				res.StrictMatches = bytes.Equal(a, b)
+			}
+
+			got, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(file, ".json") + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parse result differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestParseReplyErrors(t *testing.T) {
+	tests := []struct {
+		reply  string
+		strict bool
+		reason string
+	}{
+		{`{"not": "an array"}`, false, ReasonNotJSON},
+		{`[1, 2, 3]`, false, ReasonNotJSON},
+		{`["9.3 - ETH", "21"]`, false, ReasonShort},
+		{`["v", "1", "1;1;0", "1;hot"]`, true, ReasonBadNumber},
+		{`["v", "1", "100", "1", "", "", "1;1"]`, false, ReasonTotals},
+		{`["v", "1", "1;1;0", "1;1", "", "", "60;50"]`, true, ReasonGPUCount},
+		{`["v", "1", "1;1;0", "1", "", "", "hot;50"]`, true, ReasonBadNumber},
+		{`["v", "1", "1;1;0", "1", "", "", "60;50", "pool", "", "1;2", "0"]`, true, ReasonGPUCount},
+	}
+
+	for _, tt := range tests {
+		reply := json.RawMessage(tt.reply)
+		_, err := ParseReply(&reply, tt.strict)
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("ParseReply(%s, %v) = %v, want a parse error", tt.reply, tt.strict, err)
+			continue
+		}
+		if pe.Reason != tt.reason {
+			t.Errorf("ParseReply(%s, %v) reason = %s, want %s", tt.reply, tt.strict, pe.Reason, tt.reason)
+		}
+	}
+}
+
+func FuzzParseReply(f *testing.F) {
+	files, err := filepath.Glob("testdata/replies/*.json")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data, false)
+		f.Add(data, true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, strict bool) {
+		reply := json.RawMessage(data)
+		stats, err := ParseReply(&reply, strict)
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("error is %T, want *parseError", err)
+			}
+			if stats != nil {
+				t.Fatal("stats returned together with an error")
+			}
+			return
+		}
+
+		if !strict {
+			return
+		}
+		for _, v := range []string{stats.Uptime, stats.TotalRate, stats.EthFound, stats.EthReject} {
+			if !Numeric(v) {
+				t.Fatalf("strict mode accepted %q", v)
+			}
+		}
+		for _, g := range stats.GPUs {
+			values := []string{g.HashRate, g.Temp, g.FanSpeed}
+			if stats.Protocol == ProtoMinimal {
+				values = values[:1]
+			}
+			for _, v := range values {
+				if !Numeric(v) {
+					t.Fatalf("strict mode accepted %q for %s", v, g.Name)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkParseReply(b *testing.B) {
+	reply := readReply(b, "testdata/replies/claymore_getstat2.json")
+	for _, strict := range []bool{false, true} {
+		b.Run(fmt.Sprintf("strict=%v", strict), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseReply(reply, strict); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package claymore
+
+// Stats is a miner's reply, its fields as the miner reports them, e.g.
+// hashrates in kH/s. Fields a reply's protocol level doesn't have are
+// empty.
+type Stats struct {
+	Version   string    `json:"version"`
+	Uptime    string    `json:"uptime"`
+	TotalRate string    `json:"totalrate"`
+	EthFound  string    `json:"ethfound"`
+	EthReject string    `json:"ethreject"`
+	Pool      string    `json:"pool"`
+	GPUs      []GPUInfo `json:"gpuinfo"`
+	// Protocol is the reply's protocol level, from its number of fields.
+	Protocol string `json:"protocol"`
+
+	// Secondary coin totals when dual mining, from result[4].
+	SecondaryRate   string `json:"secondaryrate"`
+	SecondaryFound  string `json:"secondaryfound"`
+	SecondaryReject string `json:"secondaryreject"`
+	SecondaryPool   string `json:"secondarypool"`
+}
+
+// GPUInfo is a GPU of a Stats.
+type GPUInfo struct {
+	Name     string
+	HashRate string
+	Temp     string
+	FanSpeed string
+	Accepted string
+	Rejected string
+	Bus      string
+	// Enabled is false when the miner reports the GPU as "off".
+	Enabled bool
+	// SecondaryHashRate is the GPU's secondary coin hashrate, "off" for a
+	// GPU that mines the primary coin only.
+	SecondaryHashRate string
+}
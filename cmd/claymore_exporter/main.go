@@ -0,0 +1,15 @@
+// Command claymore_exporter exports the stats of Claymore's miner and
+// miners like it to Prometheus. Its commands are those of exporter.NewRootCmd.
+package main
+
+import (
+	"os"
+
+	"github.com/murat1985/claymore_exporter/exporter"
+)
+
+func main() {
+	if err := exporter.NewRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var gpuCoolingAdvisoryDesc = prometheus.NewDesc(
+	"claymore_gpu_cooling_advisory",
+	"1 if the GPU runs hot with its fan slow (reason hot_low_fan) or at its power limit (reason power_limited), hinting at a misconfigured fan curve",
+	[]string{"Rig", "GPU", "reason"},
+	nil)
+
+const (
+	advisoryHotLowFan    = "hot_low_fan"
+	advisoryPowerLimited = "power_limited"
+)
+
+// coolingAdvisory holds the --advisory.* thresholds. A GPU at HotTemp °C
+// or more is hot; it is flagged if its fan runs at LowFan % or less, or
+// its power draw is at least PowerLimitRatio of its limit, which needs a
+// GPU sensor backend reporting both.
+type coolingAdvisory struct {
+	HotTemp         float64
+	LowFan          float64
+	PowerLimitRatio float64
+}
+
+var advisory = coolingAdvisory{HotTemp: 70, LowFan: 50, PowerLimitRatio: 0.97}
+
+// reasons returns why the GPU is flagged, nothing if it isn't hot or the
+// advisory is disabled with a zero HotTemp. r is nil without sensor
+// readings for the GPU.
+func (a coolingAdvisory) reasons(gpu claymore.GPUInfo, r *gpuReadings) []string {
+	temp, err := strconv.ParseFloat(gpu.Temp, 64)
+	if a.HotTemp <= 0 || err != nil || temp < a.HotTemp {
+		return nil
+	}
+	var reasons []string
+	if fan, err := strconv.ParseFloat(gpu.FanSpeed, 64); err == nil && fan <= a.LowFan {
+		reasons = append(reasons, advisoryHotLowFan)
+	}
+	if r != nil && r.power != nil && r.powerLimit != nil && *r.powerLimit > 0 &&
+		*r.power >= a.PowerLimitRatio**r.powerLimit {
+		reasons = append(reasons, advisoryPowerLimited)
+	}
+	return reasons
+}
+
+// coolingAdvisoryMetrics exports the flagged GPUs of the rig, one series
+// per reason. readings may be nil.
+func coolingAdvisoryMetrics(addr string, stats *claymore.Stats, readings map[int]gpuReadings) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for i, gpu := range stats.GPUs {
+		if !gpu.Enabled {
+			continue
+		}
+		var r *gpuReadings
+		if gr, ok := readings[i]; ok {
+			r = &gr
+		}
+		for _, reason := range advisory.reasons(gpu, r) {
+			metrics = append(metrics, prometheus.MustNewConstMetric(gpuCoolingAdvisoryDesc,
+				prometheus.GaugeValue,
+				1,
+				addr, gpu.Name, reason))
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+func knownRig(conf *expConf, rig string) bool {
+	for _, addr := range conf.Dial_Addr {
+		if addr == rig {
+			return true
+		}
+	}
+	return false
+}
+
+// rigsHandler serves /api/v1/rigs/{rig}/{action}.
+func rigsHandler(h *history) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf := currentConf()
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/rigs/"), "/")
+		if len(parts) != 2 || !knownRig(conf, parts[0]) {
+			http.NotFound(w, r)
+			return
+		}
+		rig, action := parts[0], parts[1]
+
+		switch action {
+		case "history":
+			historyHandler(w, r, h, rig)
+		case "reboot":
+			controlHandler(w, r, conf, rig, methodReboot)
+		case "restart":
+			controlHandler(w, r, conf, rig, methodRestart)
+		case "gpu":
+			gpuControlHandler(w, r, conf, rig)
+		case "maintenance":
+			maintenanceHandler(w, r, conf, rig)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// targetsHandler serves /api/v1/targets: GET lists the targets, POST with
+// {"target": "host[:port]"} adds one and DELETE /api/v1/targets/{target}
+// removes one. Changes need the control token.
+func targetsHandler(w http.ResponseWriter, r *http.Request) {
+	conf := currentConf()
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"targets": conf.Dial_Addr})
+		return
+	}
+
+	var action, target string
+	switch r.Method {
+	case http.MethodPost:
+		action = "add_target"
+	case http.MethodDelete:
+		action = "remove_target"
+		target = strings.TrimPrefix(r.URL.Path, "/api/v1/targets/")
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	who, denied := requireScope(w, r, conf, scopeControl)
+	if len(denied) != 0 {
+		audit(r, auditEvent{Who: who, Action: action, Rig: target, Result: denied})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		target = strings.TrimSpace(req.Target)
+	}
+	if len(target) == 0 || strings.ContainsAny(target, "/; \t\n") {
+		http.Error(w, "bad target", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodPost {
+		err = runtimeTargets.add(target)
+	} else {
+		if !knownRig(conf, target) {
+			http.NotFound(w, r)
+			return
+		}
+		err = runtimeTargets.remove(target)
+	}
+	if err == nil {
+		err = reloadConf()
+	}
+	if err != nil {
+		audit(r, auditEvent{Who: who, Action: action, Rig: target, Result: auditError, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, auditEvent{Who: who, Action: action, Rig: target, Result: auditOK})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadHandler serves POST /-/reload, which reloads the configuration like
+// SIGHUP does. It needs the control token.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	who, denied := requireScope(w, r, currentConf(), scopeControl)
+	if len(denied) != 0 {
+		audit(r, auditEvent{Who: who, Action: "reload", Result: denied})
+		return
+	}
+	if err := reloadConf(); err != nil {
+		audit(r, auditEvent{Who: who, Action: "reload", Result: auditError, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit(r, auditEvent{Who: who, Action: "reload", Result: auditOK})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Audit results of control API calls.
+const (
+	auditOK           = "ok"
+	auditError        = "error"
+	auditDryRun       = "dry-run"
+	auditUnauthorized = "unauthorized"
+	auditForbidden    = "forbidden"
+	// A command that needs confirming, and a confirmation that didn't
+	// match, see controlGuard.
+	auditConfirmRequired = "confirm-required"
+	auditBadConfirm      = "bad-confirm"
+	auditRateLimited     = "rate-limited"
+	// A command to a rig with a read-only API, see probeWritable.
+	auditReadOnly = "read-only"
+)
+
+var controlActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "claymore_control_actions_total",
+	Help: "Control API calls by action and result",
+}, []string{"action", "result"})
+
+// auditEvent is one control API call. Action is the miner method for rig
+// commands, add_target, remove_target or reload otherwise.
+type auditEvent struct {
+	Time   time.Time `json:"time"`
+	Remote string    `json:"remote"`
+	Who    string    `json:"who,omitempty"`
+	Action string    `json:"action"`
+	Rig    string    `json:"rig,omitempty"`
+	Params []string  `json:"params,omitempty"`
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// auditFile is where events are written as JSON lines, with
+// --audit.log-file.
+var auditFile struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func openAuditLog(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	auditFile.Lock()
+	auditFile.w = f
+	auditFile.Unlock()
+	return nil
+}
+
+// audit records a control API call in the exporter log, the audit log file
+// and claymore_control_actions_total.
+func audit(r *http.Request, e auditEvent) {
+	e.Time = time.Now()
+	e.Remote = r.RemoteAddr
+	controlActions.WithLabelValues(e.Action, e.Result).Inc()
+
+	msg := fmt.Sprintf("audit: remote=%s who=%s action=%s", e.Remote, e.Who, e.Action)
+	if len(e.Rig) != 0 {
+		msg += " rig=" + e.Rig
+	}
+	if len(e.Params) != 0 {
+		msg += " params=" + strings.Join(e.Params, ",")
+	}
+	msg += " result=" + e.Result
+	if len(e.Error) != 0 {
+		msg += fmt.Sprintf(" err=%q", e.Error)
+	}
+	log.Print(msg)
+
+	auditFile.Lock()
+	defer auditFile.Unlock()
+	if auditFile.w == nil {
+		return
+	}
+	if err := json.NewEncoder(auditFile.w).Encode(e); err != nil {
+		log.Printf("Writing audit log: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package exporter
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Scopes of API credentials. A control credential may also read.
+const (
+	scopeRead    = "read"
+	scopeControl = "control"
+)
+
+// authConf configures API credentials beyond CLAYMORE_CONTROL_TOKEN, in
+// the "auth" section of CLAYMORE_CONFIG.
+type authConf struct {
+	Tokens []tokenConf `json:"tokens"`
+	// Clients maps the common name of a verified TLS client certificate
+	// (see --web.tls-client-ca-file) to its scope.
+	Clients map[string]string `json:"clients"`
+	// ProtectReads makes every endpoint, /metrics included, require a
+	// credential with at least the read scope.
+	ProtectReads bool `json:"protect_reads"`
+	// Proxy trusts the user name an authenticating reverse proxy passes.
+	Proxy *proxyAuthConf `json:"proxy"`
+}
+
+// proxyAuthConf accepts users authenticated by a reverse proxy in front of
+// the exporter, e.g. oauth2-proxy doing OIDC login, which passes the user
+// name in a header.
+type proxyAuthConf struct {
+	// Header carries the user name, X-Forwarded-User by default.
+	Header string `json:"header"`
+	// TrustedProxies are the CIDRs the header is accepted from. Anyone
+	// else could set it themselves.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// Users maps user names to scopes; others get DefaultScope, if set.
+	Users        map[string]string `json:"users"`
+	DefaultScope string            `json:"default_scope"`
+}
+
+func (p *proxyAuthConf) header() string {
+	if len(p.Header) == 0 {
+		return "X-Forwarded-User"
+	}
+	return p.Header
+}
+
+// trusted tells whether the request comes straight from a trusted proxy.
+func (p *proxyAuthConf) trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, cidr := range p.TrustedProxies {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenConf is a bearer token. Name identifies it in the audit log.
+type tokenConf struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Scope string `json:"scope"`
+}
+
+func validScope(scope string) bool {
+	return scope == scopeRead || scope == scopeControl
+}
+
+func tokenMatches(got, want string) bool {
+	return len(want) != 0 && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// authenticate returns who made the request and their scope, from a
+// bearer token, a verified client certificate or a trusted proxy's user
+// header. A proxy user without a scope is known but may do nothing.
+func authenticate(r *http.Request, conf *expConf) (who, scope string, ok bool) {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); len(token) != 0 {
+		if tokenMatches(token, conf.ControlToken) {
+			return "control_token", scopeControl, true
+		}
+		if auth := conf.auth(); auth != nil {
+			for _, t := range auth.Tokens {
+				if tokenMatches(token, t.Token) {
+					return "token:" + t.Name, t.Scope, true
+				}
+			}
+		}
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if auth := conf.auth(); auth != nil {
+			if scope, ok := auth.Clients[cn]; ok {
+				return "cert:" + cn, scope, true
+			}
+		}
+	}
+
+	if auth := conf.auth(); auth != nil && auth.Proxy != nil {
+		p := auth.Proxy
+		if user := r.Header.Get(p.header()); len(user) != 0 && p.trusted(r) {
+			scope, ok := p.Users[user]
+			if !ok {
+				scope = p.DefaultScope
+			}
+			return "user:" + user, scope, true
+		}
+	}
+	return "", "", false
+}
+
+// requireScope checks that the request carries a credential with scope. If
+// not it answers 401 or 403 and returns the result to audit. who is empty
+// for anonymous requests.
+func requireScope(w http.ResponseWriter, r *http.Request, conf *expConf, scope string) (who, denied string) {
+	who, got, ok := authenticate(r, conf)
+	switch {
+	case !ok:
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", auditUnauthorized
+	case got != scope && got != scopeControl:
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return who, auditForbidden
+	}
+	return who, ""
+}
+
+// protectReads makes h require the read scope when the config asks for it,
+// or override says so. /-/healthy stays open for health checks.
+func protectReads(h http.Handler, override *bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf := currentConf()
+		protect := false
+		if auth := conf.auth(); auth != nil {
+			protect = auth.ProtectReads
+		}
+		if override != nil {
+			protect = *override
+		}
+		if protect && r.URL.Path != "/-/healthy" {
+			if _, denied := requireScope(w, r, conf, scopeRead); len(denied) != 0 {
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serverTLSConfig asks clients for a certificate signed by one of the CAs in
+// clientCAFile, if given. Clients without one can still use tokens.
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(clientCAFile) == 0 {
+		return tc, nil
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+	}
+	tc.ClientCAs = pool
+	tc.ClientAuth = tls.VerifyClientCertIfGiven
+	return tc, nil
+}
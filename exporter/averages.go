@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hashrateAverageDesc = prometheus.NewDesc(
+		"claymore_hashrate_average_hashes_per_second",
+		"Exponentially weighted moving average of the total hashrate",
+		[]string{"Rig", "window"},
+		nil)
+
+	gpuHashrateAverageDesc = prometheus.NewDesc(
+		"claymore_gpu_hashrate_average_hashes_per_second",
+		"Exponentially weighted moving average of the GPU hashrate",
+		[]string{"Rig", "GPU", "window"},
+		nil)
+)
+
+// averageWindows are the time constants of the exported averages.
+var averageWindows = []struct {
+	name string
+	d    time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+}
+
+// ewma is an exponentially weighted moving average over irregularly spaced
+// samples: each sample's weight depends on the time since the previous one.
+type ewma struct {
+	value float64
+	last  time.Time
+}
+
+func (e *ewma) update(v float64, t time.Time, window time.Duration) {
+	if e.last.IsZero() {
+		e.value, e.last = v, t
+		return
+	}
+	alpha := 1 - math.Exp(-float64(t.Sub(e.last))/float64(window))
+	e.value += alpha * (v - e.value)
+	e.last = t
+}
+
+// rigAverages holds a rig's averages, one per window for the total and for
+// each GPU.
+type rigAverages struct {
+	total []ewma
+	gpus  map[string][]ewma
+}
+
+func newRigAverages() *rigAverages {
+	return &rigAverages{
+		total: make([]ewma, len(averageWindows)),
+		gpus:  make(map[string][]ewma),
+	}
+}
+
+// averageMetrics folds the rig's new sample into its averages and returns
+// them. Disabled GPUs keep their last average but aren't exported.
+func (c *ClaymoreStatsCollector) averageMetrics(addr string, stats *claymore.Stats, now time.Time) []prometheus.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	avg, ok := c.averages[addr]
+	if !ok {
+		avg = newRigAverages()
+		c.averages[addr] = avg
+	}
+
+	var metrics []prometheus.Metric
+
+	total, _ := strconv.ParseFloat(stats.TotalRate, 64)
+	for i, w := range averageWindows {
+		avg.total[i].update(total, now, w.d)
+		metrics = append(metrics, prometheus.MustNewConstMetric(hashrateAverageDesc,
+			prometheus.GaugeValue,
+			avg.total[i].value*1000,
+			addr, w.name))
+	}
+
+	for _, gpu := range stats.GPUs {
+		// A hashrate dropped by the sanity checks doesn't move the average.
+		if !gpu.Enabled || len(gpu.HashRate) == 0 {
+			continue
+		}
+		g, ok := avg.gpus[gpu.Name]
+		if !ok {
+			g = make([]ewma, len(averageWindows))
+			avg.gpus[gpu.Name] = g
+		}
+		rate, _ := strconv.ParseFloat(gpu.HashRate, 64)
+		for i, w := range averageWindows {
+			g[i].update(rate, now, w.d)
+			metrics = append(metrics, prometheus.MustNewConstMetric(gpuHashrateAverageDesc,
+				prometheus.GaugeValue,
+				g[i].value*1000,
+				addr, gpu.Name, w.name))
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,91 @@
+package exporter
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hashrateExpectedDesc = prometheus.NewDesc(
+		"claymore_hashrate_expected_hashes_per_second",
+		"Expected total hashrate of the rig, configured or learned from history",
+		[]string{"Rig"},
+		nil)
+
+	hashrateDeviationDesc = prometheus.NewDesc(
+		"claymore_hashrate_deviation_ratio",
+		"Relative deviation of the total hashrate from the expected one, -0.4 for a rig at 60%",
+		[]string{"Rig"},
+		nil)
+)
+
+// baselineRefresh is how often a learned baseline is computed again.
+const baselineRefresh = 10 * time.Minute
+
+// learnedBaseline is a rig's baseline hashrate and when it was computed.
+type learnedBaseline struct {
+	value float64
+	time  time.Time
+}
+
+// medianHashrate returns the median of the non-zero total hashrates in samples,
+// skipping the zeros of a rig that was down or restarting.
+func medianHashrate(samples []historySample) float64 {
+	var rates []float64
+	for _, s := range samples {
+		if s.TotalRate > 0 {
+			rates = append(rates, s.TotalRate)
+		}
+	}
+	if len(rates) == 0 {
+		return 0
+	}
+	sort.Float64s(rates)
+	return rates[len(rates)/2]
+}
+
+// expectedHashrate returns the rig's configured expected hashrate, or the
+// median over the last baselineWindow of history, or 0 if there is neither.
+func (c *ClaymoreStatsCollector) expectedHashrate(addr string, conf *expConf, now time.Time) float64 {
+	if expected := conf.rig(addr).ExpectedHashrate; expected > 0 {
+		return expected
+	}
+	if c.history == nil || c.baselineWindow <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	b, ok := c.baselines[addr]
+	c.mu.Unlock()
+	if ok && now.Sub(b.time) < baselineRefresh {
+		return b.value
+	}
+
+	b = learnedBaseline{value: medianHashrate(c.history.query(addr, now.Add(-c.baselineWindow))), time: now}
+	c.mu.Lock()
+	c.baselines[addr] = b
+	c.mu.Unlock()
+	return b.value
+}
+
+func (c *ClaymoreStatsCollector) deviationMetrics(addr string, conf *expConf, stats *claymore.Stats, now time.Time) []prometheus.Metric {
+	expected := c.expectedHashrate(addr, conf, now)
+	if expected <= 0 {
+		return nil
+	}
+	current, _ := strconv.ParseFloat(stats.TotalRate, 64)
+	return []prometheus.Metric{
+		prometheus.MustNewConstMetric(hashrateExpectedDesc,
+			prometheus.GaugeValue,
+			expected*1000,
+			addr),
+		prometheus.MustNewConstMetric(hashrateDeviationDesc,
+			prometheus.GaugeValue,
+			(current-expected)/expected,
+			addr),
+	}
+}
@@ -0,0 +1,98 @@
+package exporter
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	droppedTargetsDesc = prometheus.NewDesc(
+		"claymore_exporter_dropped_targets",
+		"Targets left out because there are more than --limits.max-rigs",
+		nil,
+		nil)
+
+	droppedGPUsDesc = prometheus.NewDesc(
+		"claymore_exporter_dropped_gpus",
+		"GPUs of the rig left out because it reports more than --limits.max-gpus-per-rig",
+		[]string{"Rig"},
+		nil)
+)
+
+// cardinalityGuard caps the rigs and GPUs the exporter exports, so
+// discovery picking up a whole subnet or a miner reporting garbage GPU
+// lists can't flood Prometheus with series.
+type cardinalityGuard struct {
+	// maxRigs and maxGPUs are the caps, 0 for none.
+	maxRigs, maxGPUs int
+
+	mu          sync.Mutex
+	droppedRigs int
+	droppedGPUs map[string]int
+}
+
+var limits = &cardinalityGuard{droppedGPUs: make(map[string]int)}
+
+// rigs returns the first maxRigs targets.
+func (g *cardinalityGuard) rigs(targets []string) []string {
+	dropped := 0
+	if g.maxRigs > 0 && len(targets) > g.maxRigs {
+		dropped = len(targets) - g.maxRigs
+		shown := targets[g.maxRigs:]
+		if len(shown) > 5 {
+			shown = append(shown[:5:5], "...")
+		}
+		log.Printf("WARNING: %d targets exceed --limits.max-rigs=%d and are NOT scraped: %s", dropped, g.maxRigs, strings.Join(shown, ", "))
+		targets = targets[:g.maxRigs]
+	}
+	g.mu.Lock()
+	g.droppedRigs = dropped
+	g.mu.Unlock()
+	return targets
+}
+
+// gpus returns the rig's first maxGPUs GPUs.
+func (g *cardinalityGuard) gpus(rig string, gpus []claymore.GPUInfo) []claymore.GPUInfo {
+	if g.maxGPUs <= 0 {
+		return gpus
+	}
+	dropped := 0
+	if len(gpus) > g.maxGPUs {
+		dropped = len(gpus) - g.maxGPUs
+		gpus = gpus[:g.maxGPUs]
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if dropped != g.droppedGPUs[rig] && dropped > 0 {
+		log.Printf("WARNING: %s reports %d GPUs, more than --limits.max-gpus-per-rig=%d; %d are NOT exported", rig, len(gpus)+dropped, g.maxGPUs, dropped)
+	}
+	if dropped > 0 {
+		g.droppedGPUs[rig] = dropped
+	} else {
+		delete(g.droppedGPUs, rig)
+	}
+	return gpus
+}
+
+func (g *cardinalityGuard) Describe(ch chan<- *prometheus.Desc) {
+	ch <- droppedTargetsDesc
+	ch <- droppedGPUsDesc
+}
+
+func (g *cardinalityGuard) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(droppedTargetsDesc,
+		prometheus.GaugeValue,
+		float64(g.droppedRigs))
+	for rig, n := range g.droppedGPUs {
+		ch <- prometheus.MustNewConstMetric(droppedGPUsDesc,
+			prometheus.GaugeValue,
+			float64(n),
+			rig)
+	}
+}
@@ -0,0 +1,344 @@
+package exporter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// startSimulator serves a simulated rig over loopback until the test ends
+// and returns its address.
+func startSimulator(tb testing.TB, gpus int) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { lis.Close() })
+	sim := &simulator{gpus: gpus, start: time.Now()}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go sim.handle(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+// BenchmarkCollect scrapes a simulated 12 GPU rig over loopback, as
+// /metrics would without caching.
+func BenchmarkCollect(b *testing.B) {
+	conf := fillDefaults()
+	conf.Dial_Addr = []string{startSimulator(b, 12)}
+	conf.Method = "miner_getstat2"
+	liveConf.Store(conf)
+
+	c := NewClaymoreStatsCollector(collectorOpts{LegacyNames: true})
+	ch := make(chan prometheus.Metric, 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Collect(ch)
+		for len(ch) > 0 {
+			<-ch
+		}
+	}
+}
+
+// authTestConf serves rig with a control token, a read-scoped token and a
+// proxy trusted from 10.0.0.0/8.
+func authTestConf(rig string) *expConf {
+	conf := fillDefaults()
+	conf.Dial_Addr = []string{rig}
+	conf.ControlToken = "control-secret"
+	conf.File = &fileConf{Auth: &authConf{
+		Tokens: []tokenConf{{Name: "grafana", Token: "read-secret", Scope: scopeRead}},
+		Proxy: &proxyAuthConf{
+			TrustedProxies: []string{"10.0.0.0/8"},
+			Users:          map[string]string{"ops": scopeControl},
+		},
+	}}
+	liveConf.Store(conf)
+	return conf
+}
+
+func controlRequest(rig, action, token, query string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/rigs/"+rig+"/"+action+query, nil)
+	if len(token) != 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func serveControl(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	rigsHandler(nil)(w, r)
+	return w
+}
+
+func TestControlAuth(t *testing.T) {
+	authTestConf("127.0.0.1:3333")
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"bad token", "guess", http.StatusUnauthorized},
+		{"read token", "read-secret", http.StatusForbidden},
+		{"control token", "control-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		for _, action := range []string{"restart", "reboot"} {
+			w := serveControl(controlRequest("127.0.0.1:3333", action, tt.token, "?dry_run=1"))
+			if w.Code != tt.want {
+				t.Errorf("%s: %s got %d, want %d", tt.name, action, w.Code, tt.want)
+			}
+		}
+	}
+}
+
+func TestProtectReads(t *testing.T) {
+	conf := authTestConf("127.0.0.1:3333")
+	conf.File.Auth.ProtectReads = true
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	off := false
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		override *bool
+		want     int
+	}{
+		{"no token", "/metrics", "", nil, http.StatusUnauthorized},
+		{"bad token", "/metrics", "guess", nil, http.StatusUnauthorized},
+		{"read token", "/metrics", "read-secret", nil, http.StatusOK},
+		{"control token", "/metrics", "control-secret", nil, http.StatusOK},
+		{"health check", "/-/healthy", "", nil, http.StatusOK},
+		{"listener override", "/metrics", "", &off, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if len(tt.token) != 0 {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		protectReads(ok, tt.override).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+// TestProxyAuthUntrusted checks that the user header only counts from a
+// trusted proxy's own address, not from one named in X-Forwarded-For.
+func TestProxyAuthUntrusted(t *testing.T) {
+	authTestConf("127.0.0.1:3333")
+
+	r := controlRequest("127.0.0.1:3333", "restart", "", "?dry_run=1")
+	r.RemoteAddr = "192.0.2.1:40000"
+	r.Header.Set("X-Forwarded-User", "ops")
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if w := serveControl(r); w.Code != http.StatusUnauthorized {
+		t.Errorf("untrusted proxy: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r = controlRequest("127.0.0.1:3333", "restart", "", "?dry_run=1")
+	r.RemoteAddr = "10.0.0.1:40000"
+	r.Header.Set("X-Forwarded-User", "ops")
+	if w := serveControl(r); w.Code != http.StatusOK {
+		t.Errorf("trusted proxy: got %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestControlRateLimit(t *testing.T) {
+	rig := startSimulator(t, 2)
+	authTestConf(rig)
+	guard.limit, guard.window = 1, time.Minute
+	defer func() {
+		guard.limit, guard.window = 0, 0
+		guard.sent = make(map[string][]time.Time)
+	}()
+
+	if w := serveControl(controlRequest(rig, "restart", "control-secret", "")); w.Code != http.StatusOK {
+		t.Fatalf("first command: got %d %q, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	w := serveControl(controlRequest(rig, "restart", "control-secret", ""))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second command: got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if len(w.Header().Get("Retry-After")) == 0 {
+		t.Error("no Retry-After on a rate-limited command")
+	}
+}
+
+func TestControlConfirm(t *testing.T) {
+	rig := startSimulator(t, 2)
+	authTestConf(rig)
+	guard.confirm = map[string]bool{methodRestart: true, methodReboot: true}
+	defer func() { guard.confirm = nil }()
+
+	w := serveControl(controlRequest(rig, "restart", "control-secret", ""))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("unconfirmed command: got %d, want %d", w.Code, http.StatusAccepted)
+	}
+	var reply struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil || len(reply.Confirm) == 0 {
+		t.Fatalf("no confirmation token: %v", err)
+	}
+
+	query := "?confirm=" + reply.Confirm
+	if w := serveControl(controlRequest(rig, "reboot", "control-secret", query)); w.Code != http.StatusConflict {
+		t.Errorf("token for another method: got %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := serveControl(controlRequest(rig, "restart", "control-secret", query)); w.Code != http.StatusOK {
+		t.Fatalf("confirmed command: got %d %q, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	if w := serveControl(controlRequest(rig, "restart", "control-secret", query)); w.Code != http.StatusConflict {
+		t.Errorf("reused token: got %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	tc, err := serverTLSConfig("")
+	if err != nil || tc.ClientCAs != nil || tc.ClientAuth != tls.NoClientCert {
+		t.Errorf("without CAs: got %+v, %v", tc, err)
+	}
+	if _, err := serverTLSConfig(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("missing CA file: no error")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0600)
+	if _, err := serverTLSConfig(empty); err == nil {
+		t.Error("CA file without certificates: no error")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	tc, err = serverTLSConfig(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.ClientCAs == nil || tc.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("with CA: got ClientAuth %v", tc.ClientAuth)
+	}
+	if tc.MinVersion < tls.VersionTLS12 {
+		t.Errorf("MinVersion %x, want at least TLS 1.2", tc.MinVersion)
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+	m := &dto.Metric{Label: []*dto.LabelPair{
+		{Name: proto.String("Rig"), Value: proto.String("rig1:3333")},
+		{Name: proto.String("miner"), Value: proto.String("custom")},
+	}}
+	setLabel(m, "miner", "claymore")
+	if len(m.Label) != 2 {
+		t.Fatalf("got %d labels, want 2", len(m.Label))
+	}
+	if v, _ := metricLabel(m, "miner"); v != "claymore" {
+		t.Errorf("miner = %q, want claymore", v)
+	}
+
+	setLabel(m, "GPU", "GPU0")
+	if len(m.Label) != 3 || m.Label[0].GetName() != "GPU" {
+		t.Errorf("new label not added in order: %v", m.Label)
+	}
+}
+
+func TestMaintenanceDelete(t *testing.T) {
+	const rig = "127.0.0.1:3333"
+	conf := authTestConf(rig)
+	conf.File.Rigs = map[string]rigConf{rig: {Maintenance: true, Note: "riser swap"}}
+	maintenanceRequest := func(method, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/rigs/"+rig+"/maintenance", strings.NewReader(body))
+		if len(token) != 0 {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serveControl(r)
+	}
+
+	if w := maintenanceRequest(http.MethodPut, "", "not json"); w.Code != http.StatusUnauthorized {
+		t.Errorf("PUT without token: got %d, want 401", w.Code)
+	}
+	if w := maintenanceRequest(http.MethodPut, "control-secret", `{"note": "PSU swap"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT: got %d", w.Code)
+	}
+	if st := maintenance.get(conf, rig); !st.On || st.Note != "PSU swap" {
+		t.Errorf("after PUT: got %+v", st)
+	}
+	if w := maintenanceRequest(http.MethodDelete, "control-secret", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: got %d", w.Code)
+	}
+	if st := maintenance.get(conf, rig); !st.On || st.Note != "riser swap" {
+		t.Errorf("after DELETE: got %+v, want the config file's mode", st)
+	}
+}
+
+func TestTargetsAuth(t *testing.T) {
+	authTestConf("127.0.0.1:3333")
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+	}{
+		{"add without token", http.MethodPost, "/api/v1/targets", "not json", "", http.StatusUnauthorized},
+		{"add with read token", http.MethodPost, "/api/v1/targets", `{"target": "bad target"}`, "read-secret", http.StatusForbidden},
+		{"remove without token", http.MethodDelete, "/api/v1/targets/bad;target", "", "", http.StatusUnauthorized},
+		{"bad body", http.MethodPost, "/api/v1/targets", "not json", "control-secret", http.StatusBadRequest},
+		{"bad target", http.MethodPost, "/api/v1/targets", `{"target": "bad target"}`, "control-secret", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if len(tt.token) != 0 {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		targetsHandler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// NewRootCmd builds the command line. Running the binary without a
+// subcommand serves metrics, as it always has.
+func NewRootCmd() *cobra.Command {
+	o := &serveOpts{}
+	run := func(cmd *cobra.Command, args []string) error { return serve(o) }
+
+	root := &cobra.Command{
+		Use:          "claymore_exporter",
+		Short:        "Prometheus exporter for Claymore's Dual Miner",
+		Args:         cobra.NoArgs,
+		RunE:         run,
+		SilenceUsage: true,
+	}
+	root.CompletionOptions.DisableDefaultCmd = true
+	addServeFlags(root.Flags(), o)
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve metrics and the API (the default)",
+		Args:  cobra.NoArgs,
+		RunE:  run,
+	}
+	addServeFlags(serveCmd.Flags(), o)
+
+	root.AddCommand(serveCmd, newQueryCmd(), newCheckConfigCmd(), newSimulateCmd(), newControlCmd(), newHealthcheckCmd())
+	return root
+}
+
+// readConfFor reads the configuration for commands that work on a target
+// given on the command line, which don't need CLAYMORE_DIAL_ADDR.
+func readConfFor(target string) (*expConf, error) {
+	os.Setenv("CLAYMORE_DIAL_ADDR", target)
+	return readConf()
+}
+
+func newCheckConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check-config",
+		Short: "Validate the CLAYMORE_* environment and config file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := readConf()
+			if err != nil {
+				return err
+			}
+
+			problems := checkConf(conf)
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+			if len(problems) != 0 {
+				return fmt.Errorf("found %d problem(s)", len(problems))
+			}
+			fmt.Println("config OK")
+			return nil
+		},
+	}
+}
+
+func newControlCmd() *cobra.Command {
+	var target string
+
+	control := &cobra.Command{
+		Use:   "control",
+		Short: "Send a management command to a rig",
+		Long: "Send a management command to a rig. The miner must run with a writable " +
+			"API (positive -mport); its -mpsw is read from CLAYMORE_PASSWORD or Vault.",
+	}
+	control.PersistentFlags().StringVar(&target, "target", "", "Rig to control, host or host:port.")
+	control.MarkPersistentFlagRequired("target")
+
+	send := func(method string, params ...string) error {
+		conf, err := readConfFor(target)
+		if err != nil {
+			return err
+		}
+		writable, err := probeWritable(target, conf)
+		if err != nil {
+			return fmt.Errorf("can't reach %s: %v", target, err)
+		}
+		if !writable {
+			return errReadOnly(target)
+		}
+		if err := sendMinerCommand(target, conf, method, params...); err != nil {
+			return err
+		}
+		fmt.Printf("sent %s to %s\n", method, target)
+		return nil
+	}
+
+	control.AddCommand(&cobra.Command{
+		Use:   "restart",
+		Short: "Restart the miner",
+		Args:  cobra.NoArgs,
+		RunE:  func(cmd *cobra.Command, args []string) error { return send(methodRestart) },
+	})
+	control.AddCommand(&cobra.Command{
+		Use:   "reboot",
+		Short: "Make the miner run its reboot script",
+		Args:  cobra.NoArgs,
+		RunE:  func(cmd *cobra.Command, args []string) error { return send(methodReboot) },
+	})
+
+	var index, state int
+	gpu := &cobra.Command{
+		Use:   "gpu",
+		Short: "Set a GPU's state: 0 disabled, 1 primary coin only, 2 dual",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if state < 0 || state > 2 {
+				return fmt.Errorf("bad GPU state %d, want 0, 1 or 2", state)
+			}
+			return send(methodGPU, strconv.Itoa(index), strconv.Itoa(state))
+		},
+	}
+	gpu.Flags().IntVar(&index, "index", -1, "GPU index, -1 for all GPUs.")
+	gpu.Flags().IntVar(&state, "state", 0, "0 disabled, 1 primary coin only, 2 dual.")
+	gpu.MarkFlagRequired("state")
+	control.AddCommand(gpu)
+
+	return control
+}
@@ -0,0 +1,258 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// comparePeriod is a span of history a comparison averages over.
+type comparePeriod struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// periodAverages are a rig's or GPU's averages over a period, from the
+// samples in which the rig was up. Temp, fan speed and power are missing
+// without samples reporting them, efficiency without power draws.
+type periodAverages struct {
+	Samples    int      `json:"samples"`
+	HashRate   float64  `json:"hashrate"`
+	Temp       *float64 `json:"temp,omitempty"`
+	FanSpeed   *float64 `json:"fanspeed,omitempty"`
+	Power      *float64 `json:"power,omitempty"`
+	Efficiency *float64 `json:"efficiency,omitempty"`
+}
+
+// averager sums a period's samples.
+type averager struct {
+	n                  int
+	rate               float64
+	temp, fan          float64
+	temps              int
+	power, poweredRate float64
+	powered            int
+}
+
+// add adds a GPU's values, or a rig's with its GPUs' mean temperature and
+// fan speed and summed draws. Rates are in kH/s, as Claymore reports them.
+// Temperatures of 0 are missing, as are draws of 0.
+func (a *averager) add(rate, temp, fan, power float64) {
+	a.n++
+	a.rate += rate
+	if temp > 0 {
+		a.temp += temp
+		a.fan += fan
+		a.temps++
+	}
+	if power > 0 {
+		a.power += power
+		a.poweredRate += rate
+		a.powered++
+	}
+}
+
+func (a *averager) averages() periodAverages {
+	avg := periodAverages{Samples: a.n}
+	if a.n == 0 {
+		return avg
+	}
+	avg.HashRate = a.rate / float64(a.n) * 1000
+	if a.temps > 0 {
+		temp, fan := a.temp/float64(a.temps), a.fan/float64(a.temps)
+		avg.Temp, avg.FanSpeed = &temp, &fan
+	}
+	if a.powered > 0 {
+		power := a.power / float64(a.powered)
+		efficiency := a.poweredRate * 1000 / a.power
+		avg.Power, avg.Efficiency = &power, &efficiency
+	}
+	return avg
+}
+
+// comparison is before and after of a rig or GPU. Change has the relative
+// change of hashrate and efficiency, 0.05 for 5% more, and the difference
+// of temperature and fan speed, for what both periods have.
+type comparison struct {
+	Rig    string             `json:"rig,omitempty"`
+	GPU    string             `json:"gpu,omitempty"`
+	Before periodAverages     `json:"before"`
+	After  periodAverages     `json:"after"`
+	Change map[string]float64 `json:"change"`
+	GPUs   []comparison       `json:"gpus,omitempty"`
+}
+
+func compare(rig, gpu string, before, after *averager) comparison {
+	c := comparison{Rig: rig, GPU: gpu, Before: before.averages(), After: after.averages(), Change: make(map[string]float64)}
+	b, a := c.Before, c.After
+	if b.Samples == 0 || a.Samples == 0 {
+		return c
+	}
+	if b.HashRate > 0 {
+		c.Change["hashrate"] = a.HashRate/b.HashRate - 1
+	}
+	if b.Temp != nil && a.Temp != nil {
+		c.Change["temp"] = *a.Temp - *b.Temp
+		c.Change["fanspeed"] = *a.FanSpeed - *b.FanSpeed
+	}
+	if b.Efficiency != nil && a.Efficiency != nil && *b.Efficiency > 0 {
+		c.Change["efficiency"] = *a.Efficiency / *b.Efficiency - 1
+	}
+	return c
+}
+
+// rigAveragers sums a rig's samples in a period, rig-wide and by GPU.
+// GPUs are kept in the order they first appear in.
+type rigAveragers struct {
+	rig  averager
+	gpus map[string]*averager
+	seen []string
+}
+
+func newRigAveragers() *rigAveragers {
+	return &rigAveragers{gpus: make(map[string]*averager)}
+}
+
+func (r *rigAveragers) add(s historySample) {
+	var temp, fan, power float64
+	var temps, powered int
+	for _, g := range s.GPUs {
+		a, ok := r.gpus[g.Name]
+		if !ok {
+			a = &averager{}
+			r.gpus[g.Name] = a
+			r.seen = append(r.seen, g.Name)
+		}
+		a.add(g.HashRate, g.Temp, g.FanSpeed, g.Power)
+		if g.Temp > 0 {
+			temp += g.Temp
+			fan += g.FanSpeed
+			temps++
+		}
+		if g.Power > 0 {
+			power += g.Power
+			powered++
+		}
+	}
+	if temps > 0 {
+		temp, fan = temp/float64(temps), fan/float64(temps)
+	}
+	// The rig's draw is only known when every GPU reports one.
+	if powered == 0 || powered < len(s.GPUs) {
+		power = 0
+	}
+	r.rig.add(s.TotalRate, temp, fan, power)
+}
+
+// compareRig averages the rig's history over both periods.
+func compareRig(h *history, rig string, before, after comparePeriod) comparison {
+	periods := []comparePeriod{before, after}
+	avgs := []*rigAveragers{newRigAveragers(), newRigAveragers()}
+	since := before.From
+	if after.From.Before(since) {
+		since = after.From
+	}
+	for _, s := range h.query(rig, since) {
+		if s.Down {
+			continue
+		}
+		for i, p := range periods {
+			if !s.Time.Before(p.From) && s.Time.Before(p.To) {
+				avgs[i].add(s)
+			}
+		}
+	}
+
+	c := compare(rig, "", &avgs[0].rig, &avgs[1].rig)
+	gpus := append([]string(nil), avgs[0].seen...)
+	for _, gpu := range avgs[1].seen {
+		if _, ok := avgs[0].gpus[gpu]; !ok {
+			gpus = append(gpus, gpu)
+		}
+	}
+	for _, gpu := range gpus {
+		b, a := avgs[0].gpus[gpu], avgs[1].gpus[gpu]
+		if b == nil {
+			b = &averager{}
+		}
+		if a == nil {
+			a = &averager{}
+		}
+		c.GPUs = append(c.GPUs, compare("", gpu, b, a))
+	}
+	return c
+}
+
+// parseReportTime reads a time given in RFC 3339 or Unix seconds.
+func parseReportTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q, want RFC 3339 or Unix seconds", s)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// compareHandler serves /api/v1/report/compare?from=&to=&window=&rig=,
+// comparing each rig's averages over the window starting at from with
+// those over the window starting at to, by default the last window.
+func compareHandler(h *history) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h == nil {
+			http.Error(w, "history is disabled", http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		window := time.Hour
+		if s := q.Get("window"); len(s) != 0 {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("bad window %q", s), http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		if len(q.Get("from")) == 0 {
+			http.Error(w, "from is required", http.StatusBadRequest)
+			return
+		}
+		from, err := parseReportTime(q.Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to := time.Now().Add(-window)
+		if s := q.Get("to"); len(s) != 0 {
+			if to, err = parseReportTime(s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		before := comparePeriod{From: from, To: from.Add(window)}
+		after := comparePeriod{From: to, To: to.Add(window)}
+		if after.From.Before(before.To) {
+			http.Error(w, "to must be at least a window after from", http.StatusBadRequest)
+			return
+		}
+
+		rigs := currentConf().Dial_Addr
+		if rig := q.Get("rig"); len(rig) != 0 {
+			rigs = []string{rig}
+		}
+		comparisons := []comparison{}
+		for _, rig := range rigs {
+			comparisons = append(comparisons, compareRig(h, rig, before, after))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"before": before,
+			"after":  after,
+			"rigs":   comparisons,
+		})
+	}
+}
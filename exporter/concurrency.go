@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scrapesInFlightDesc = prometheus.NewDesc(
+		"claymore_exporter_scrapes_in_flight",
+		"Rig scrapes talking to their miner right now",
+		nil, nil)
+
+	scrapesQueuedDesc = prometheus.NewDesc(
+		"claymore_exporter_scrapes_queued",
+		"Rig scrapes waiting for one of the --scrape.max-concurrency slots",
+		nil, nil)
+
+	scrapeConcurrencyDesc = prometheus.NewDesc(
+		"claymore_exporter_scrape_max_concurrency",
+		"Most rig scrapes run at once, --scrape.max-concurrency, 0 for no limit",
+		nil, nil)
+
+	scrapeSaturationDesc = prometheus.NewDesc(
+		"claymore_exporter_scrape_saturation_ratio",
+		"Share of the scrape slots in use, 1 when scrapes queue up",
+		nil, nil)
+
+	scrapeQueueWaitDesc = prometheus.NewDesc(
+		"claymore_exporter_scrape_queue_wait_seconds_total",
+		"Time rig scrapes spent waiting for a scrape slot",
+		nil, nil)
+)
+
+// scrapeLimiter bounds how many rigs are scraped at once, by /metrics and
+// the poller together, and keeps count of the scrapes running and
+// waiting.
+type scrapeLimiter struct {
+	// slots is nil without a limit.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	inFlight int
+	queued   int
+	wait     time.Duration
+}
+
+var scrapeSlots = newScrapeLimiter(32)
+
+func newScrapeLimiter(max int) *scrapeLimiter {
+	l := &scrapeLimiter{}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire waits for a free slot.
+func (l *scrapeLimiter) acquire() {
+	start := time.Now()
+	l.mu.Lock()
+	l.queued++
+	l.mu.Unlock()
+	if l.slots != nil {
+		l.slots <- struct{}{}
+	}
+	l.mu.Lock()
+	l.queued--
+	l.inFlight++
+	l.wait += time.Since(start)
+	l.mu.Unlock()
+}
+
+func (l *scrapeLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+func (l *scrapeLimiter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- scrapesInFlightDesc
+	ch <- scrapesQueuedDesc
+	ch <- scrapeConcurrencyDesc
+	ch <- scrapeSaturationDesc
+	ch <- scrapeQueueWaitDesc
+}
+
+func (l *scrapeLimiter) Collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(scrapesInFlightDesc, prometheus.GaugeValue, float64(l.inFlight))
+	ch <- prometheus.MustNewConstMetric(scrapesQueuedDesc, prometheus.GaugeValue, float64(l.queued))
+	ch <- prometheus.MustNewConstMetric(scrapeConcurrencyDesc, prometheus.GaugeValue, float64(cap(l.slots)))
+	if l.slots != nil {
+		ch <- prometheus.MustNewConstMetric(scrapeSaturationDesc, prometheus.GaugeValue, float64(l.inFlight)/float64(cap(l.slots)))
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeQueueWaitDesc, prometheus.CounterValue, l.wait.Seconds())
+}
@@ -0,0 +1,542 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+)
+
+// liveConf holds the *expConf the exporter serves with. It is replaced as a
+// whole on reload, so a scrape keeps the snapshot it started with.
+var liveConf atomic.Value
+
+func currentConf() *expConf {
+	return liveConf.Load().(*expConf)
+}
+
+// reloadConf reads the configuration again and swaps it in. On error the
+// previous configuration stays in place.
+func reloadConf() error {
+	conf, err := readConf()
+	if err != nil {
+		return err
+	}
+	for _, p := range checkConf(conf) {
+		log.Printf("Config: %s", p)
+	}
+	liveConf.Store(conf)
+	return nil
+}
+
+func reloadOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := reloadConf(); err != nil {
+			log.Printf("Reloading config: %v", err)
+			continue
+		}
+		log.Print("Config reloaded")
+	}
+}
+
+func reloadEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := reloadConf(); err != nil {
+			log.Printf("Reloading config: %v", err)
+		}
+	}
+}
+
+// fileConf is the optional JSON config file named by CLAYMORE_CONFIG. It
+// carries settings that don't fit in a single environment variable.
+type fileConf struct {
+	Rigs map[string]rigConf `json:"rigs"`
+	// Coins configures earnings estimates, keyed by coin label ("eth").
+	Coins map[string]coinConf `json:"coins"`
+	// Auth adds API credentials with scopes.
+	Auth *authConf `json:"auth"`
+	// Listeners configures each --web.listen-address.
+	Listeners map[string]listenerConf `json:"listeners"`
+	// Groups holds settings shared by the rigs naming the group.
+	Groups map[string]groupConf `json:"groups"`
+	// Zabbix maps readings to Zabbix hosts and item keys.
+	Zabbix *zabbixConf `json:"zabbix"`
+	// Webhooks are posted to when the poller sees a rig change state.
+	Webhooks []webhookConf `json:"webhooks"`
+	// Dialer tunes the connections to the miners.
+	Dialer *dialerConf `json:"dialer"`
+	// Miners configures the series of each miner type, keyed by the
+	// rigs' miner. MinerLabel adds a miner label to every rig series.
+	Miners     map[string]minerConf `json:"miners"`
+	MinerLabel bool                 `json:"miner_label"`
+}
+
+// groupConf holds settings for a group of rigs, e.g. all rigs on WiFi.
+type groupConf struct {
+	// PollInterval overrides --poll.interval for the group's rigs, e.g.
+	// "60s".
+	PollInterval string `json:"poll_interval"`
+	// DialTimeout, RPCTimeout and EmitTimeout override the --scrape.*
+	// timeouts for the group's rigs.
+	DialTimeout string `json:"dial_timeout"`
+	RPCTimeout  string `json:"rpc_timeout"`
+	EmitTimeout string `json:"emit_timeout"`
+	// Dialer overrides the top-level dialer for the group's rigs, e.g.
+	// to connect from the NIC on their VLAN.
+	Dialer *dialerConf `json:"dialer"`
+	// Miner is the miner type of the group's rigs.
+	Miner string `json:"miner"`
+}
+
+// rigConf holds per-rig overrides, keyed by the rig's dial address.
+type rigConf struct {
+	// GPUs maps the miner's GPU index ("0", "1", ...) to a stable name,
+	// e.g. the card's PCI bus id or its position in the frame.
+	GPUs map[string]string `json:"gpus"`
+	// GPUModels maps the miner's GPU index to the card model, e.g.
+	// "RX 580 8GB", for the inventory. Miners don't report it.
+	GPUModels map[string]string `json:"gpu_models"`
+	// Proto overrides CLAYMORE_PROTO for this rig, e.g. "http" where only
+	// HTTP is let through to the miner.
+	Proto string `json:"proto"`
+	// Command is run for the rig's stats with proto "exec", for miners
+	// the exporter has no backend for.
+	Command []string `json:"command"`
+	// Miner is the rig's miner type, e.g. "xmrig", "claymore" by default.
+	// It picks the prefix in miners and is the miner label's value.
+	Miner string `json:"miner"`
+	// Pools are host:port addresses to probe instead of the pools the
+	// miner reports.
+	Pools []string `json:"pools"`
+	// StratumUser, usually wallet.worker, is sent in mining.authorize by
+	// the stratum pool check.
+	StratumUser string `json:"stratum_user"`
+	// Coin and SecondaryCoin label the rig's share metrics. Coin defaults
+	// to the suffix of the miner version ("9.3 - ETH"), SecondaryCoin to
+	// dcr.
+	Coin          string `json:"coin"`
+	SecondaryCoin string `json:"secondary_coin"`
+	// ExpectedHashrate is the rig's normal total hashrate in kH/s, as
+	// Claymore reports it. Without it a baseline is learned from history.
+	ExpectedHashrate float64 `json:"expected_hashrate"`
+	// ShareDifficulty is the pool's share difficulty in hashes, e.g. 4e9
+	// for 4 GH shares, overriding the coin's. Share luck needs it.
+	ShareDifficulty float64 `json:"share_difficulty"`
+	// Plug is the smart plug the rig is powered through, for wall power
+	// readings.
+	Plug *plugConf `json:"plug"`
+	// Redfish is the BMC of the rig's host, for chassis power, inlet
+	// temperature and fan readings.
+	Redfish *redfishConf `json:"redfish"`
+	// TempLimit is the temperature in °C above which the rig's GPUs count
+	// as over their limit, GPUTempLimits overrides it by GPU index.
+	TempLimit     float64            `json:"temp_limit"`
+	GPUTempLimits map[string]float64 `json:"gpu_temp_limits"`
+	// GPUSensors reads the GPUs' memory and hotspot temperatures, clocks
+	// and power limits.
+	GPUSensors *gpuSensorsConf `json:"gpu_sensors"`
+	// OCProfile names the overclocking profile the rig's GPUs run with,
+	// GPUOCProfiles overrides it by GPU index.
+	OCProfile     string            `json:"oc_profile"`
+	GPUOCProfiles map[string]string `json:"gpu_oc_profiles"`
+	// ExtraMetrics are files, .prom in the Prometheus text format or
+	// .json, that scripts on the rig write more readings to, e.g. of the
+	// PSU. The exporter must run on the rig to read them.
+	ExtraMetrics []string `json:"extra_metrics"`
+	// Exec are commands run on every scrape of the rig, for hardware the
+	// exporter has no support for.
+	Exec []execConf `json:"exec"`
+	// LogTail counts events in the miner's log, for an exporter on the
+	// rig.
+	LogTail *logTailConf `json:"log_tail"`
+	// ZabbixHost is the rig's host name in Zabbix, overriding zabbix.host.
+	ZabbixHost string `json:"zabbix_host"`
+	// Maintenance suppresses the rig's alerts during planned work, Note
+	// says why or anything else worth knowing about the rig.
+	Maintenance bool   `json:"maintenance"`
+	Note        string `json:"note"`
+	// Group names an entry of groups whose settings apply to the rig.
+	Group string `json:"group"`
+	// PollInterval overrides --poll.interval and the group's for this
+	// rig, e.g. "10s".
+	PollInterval string `json:"poll_interval"`
+	// DialTimeout, RPCTimeout and EmitTimeout override the --scrape.*
+	// timeouts and the group's for this rig.
+	DialTimeout string `json:"dial_timeout"`
+	RPCTimeout  string `json:"rpc_timeout"`
+	EmitTimeout string `json:"emit_timeout"`
+}
+
+func readFileConf(path string) (*fileConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fc := &fileConf{}
+	if err := json.NewDecoder(f).Decode(fc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return fc, nil
+}
+
+func (c *expConf) rig(addr string) rigConf {
+	if c.File == nil {
+		return rigConf{}
+	}
+	return c.File.Rigs[addr]
+}
+
+// pollInterval returns how often the poller scrapes the rig at addr: the
+// rig's own poll_interval, its group's, or def.
+func (c *expConf) pollInterval(addr string, def time.Duration) time.Duration {
+	rc := c.rig(addr)
+	for _, s := range []string{rc.PollInterval, c.group(rc.Group).PollInterval} {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+// phaseTimeouts bound the phases of a scrape: connecting to the miner,
+// getting its reply once connected, and turning the reply into metrics,
+// which includes the sensor, pool and plug reads done along with it. An
+// emit of 0 is unbounded.
+type phaseTimeouts struct {
+	dial, rpc, emit time.Duration
+}
+
+// defaultTimeouts are the --scrape.* timeouts.
+var defaultTimeouts = phaseTimeouts{dial: 5 * time.Second, rpc: 10 * time.Second}
+
+// timeouts returns the rig's scrape timeouts: each from the rig, its
+// group, or the defaults.
+func (c *expConf) timeouts(addr string) phaseTimeouts {
+	rc := c.rig(addr)
+	gc := c.group(rc.Group)
+	pick := func(def time.Duration, values ...string) time.Duration {
+		for _, s := range values {
+			if d, err := time.ParseDuration(s); err == nil && d > 0 {
+				return d
+			}
+		}
+		return def
+	}
+	return phaseTimeouts{
+		dial: pick(defaultTimeouts.dial, rc.DialTimeout, gc.DialTimeout),
+		rpc:  pick(defaultTimeouts.rpc, rc.RPCTimeout, gc.RPCTimeout),
+		emit: pick(defaultTimeouts.emit, rc.EmitTimeout, gc.EmitTimeout),
+	}
+}
+
+// badTimeouts lists the timeouts of a rig or group that aren't positive
+// durations.
+func badTimeouts(dial, rpc, emit string) []string {
+	var bad []string
+	for _, t := range []struct{ name, value string }{
+		{"dial_timeout", dial},
+		{"rpc_timeout", rpc},
+		{"emit_timeout", emit},
+	} {
+		if d, err := time.ParseDuration(t.value); len(t.value) != 0 && (err != nil || d <= 0) {
+			bad = append(bad, fmt.Sprintf("bad %s %q", t.name, t.value))
+		}
+	}
+	return bad
+}
+
+func (c *expConf) group(name string) groupConf {
+	if c.File == nil {
+		return groupConf{}
+	}
+	return c.File.Groups[name]
+}
+
+func (c *expConf) auth() *authConf {
+	if c.File == nil {
+		return nil
+	}
+	return c.File.Auth
+}
+
+func (c *expConf) protoFor(addr string) string {
+	if proto := c.rig(addr).Proto; len(proto) != 0 {
+		return proto
+	}
+	return c.Proto
+}
+
+// passwordFor returns the miner password of a rig, preferring a per-rig
+// secret from Vault.
+func (c *expConf) passwordFor(addr string) string {
+	if password, ok := secrets.get("password." + addr); ok {
+		return password
+	}
+	return c.Password
+}
+
+// coins returns the primary and secondary coin labels of a rig.
+func (c *expConf) coins(addr string, stats *claymore.Stats) (primary, secondary string) {
+	rc := c.rig(addr)
+
+	primary = "eth"
+	if len(rc.Coin) != 0 {
+		primary = rc.Coin
+	} else if i := strings.LastIndex(stats.Version, " - "); i >= 0 {
+		if coin := strings.TrimSpace(stats.Version[i+3:]); len(coin) != 0 {
+			primary = strings.ToLower(coin)
+		}
+	}
+
+	secondary = "dcr"
+	if len(rc.SecondaryCoin) != 0 {
+		secondary = rc.SecondaryCoin
+	}
+	return primary, secondary
+}
+
+// gpuName picks the GPU label: a configured name first, then the PCI bus
+// reported by miner_getstat2 when CLAYMORE_GPU_LABEL=bus, and finally the
+// positional GPU0, GPU1, ...
+func (c *expConf) gpuName(addr string, index int, bus string) string {
+	if name, ok := c.rig(addr).GPUs[strconv.Itoa(index)]; ok {
+		return name
+	}
+	if c.GPULabel == "bus" && len(bus) != 0 {
+		return fmt.Sprintf("bus%s", bus)
+	}
+	return fmt.Sprintf("GPU%v", index)
+}
+
+// checkConf returns the problems found in conf, for check-config.
+func checkConf(conf *expConf) []string {
+	var problems []string
+	validProto := func(proto string) bool {
+		switch proto {
+		case "tcp", "tcp4", "tcp6", "raw", "http", "exec":
+			return true
+		}
+		return false
+	}
+
+	if !validProto(conf.Proto) {
+		problems = append(problems, fmt.Sprintf("CLAYMORE_PROTO: unknown protocol %q", conf.Proto))
+	}
+	if conf.Method != "miner_getstat1" && conf.Method != "miner_getstat2" {
+		problems = append(problems, fmt.Sprintf("CLAYMORE_STATS: unknown method %q", conf.Method))
+	}
+	if conf.GPULabel != "index" && conf.GPULabel != "bus" {
+		problems = append(problems, fmt.Sprintf("CLAYMORE_GPU_LABEL: unknown label %q", conf.GPULabel))
+	}
+	if len(conf.Dial_Addr) == 0 {
+		problems = append(problems, "CLAYMORE_DIAL_ADDR: no targets")
+	}
+	if conf.File == nil {
+		return problems
+	}
+
+	for addr, rc := range conf.File.Rigs {
+		if !knownRig(conf, addr) {
+			problems = append(problems, fmt.Sprintf("rig %s: not in CLAYMORE_DIAL_ADDR", addr))
+		}
+		if len(rc.Proto) != 0 && !validProto(rc.Proto) {
+			problems = append(problems, fmt.Sprintf("rig %s: unknown protocol %q", addr, rc.Proto))
+		}
+		// Two GPUs with the same name, or a name another GPU has by
+		// default, would export clashing series and fail the whole scrape.
+		named := make(map[string]int)
+		for index, name := range rc.GPUs {
+			named[name]++
+			if named[name] == 2 {
+				problems = append(problems, fmt.Sprintf("rig %s: several GPUs named %q", addr, name))
+			}
+			other := strings.TrimPrefix(name, "GPU")
+			if n, err := strconv.Atoi(other); err == nil && strconv.Itoa(n) == other && other != index && strings.HasPrefix(name, "GPU") {
+				if _, renamed := rc.GPUs[other]; !renamed {
+					problems = append(problems, fmt.Sprintf("rig %s: GPU %s named %q, the default name of GPU %s", addr, index, name, other))
+				}
+			}
+		}
+		for i, ec := range rc.Exec {
+			if len(ec.Command) == 0 {
+				problems = append(problems, fmt.Sprintf("rig %s: exec %d has no command", addr, i))
+			}
+			if ec.Format != "" && ec.Format != "json" && ec.Format != "prom" {
+				problems = append(problems, fmt.Sprintf("rig %s: exec %d: unknown format %q", addr, i, ec.Format))
+			}
+			if d, err := time.ParseDuration(ec.Timeout); len(ec.Timeout) != 0 && (err != nil || d <= 0) {
+				problems = append(problems, fmt.Sprintf("rig %s: exec %d: bad timeout %q", addr, i, ec.Timeout))
+			}
+		}
+		if lc := rc.LogTail; lc != nil {
+			if len(lc.Path) == 0 {
+				problems = append(problems, fmt.Sprintf("rig %s: log_tail has no path", addr))
+			} else if _, err := filepath.Glob(lc.Path); err != nil {
+				problems = append(problems, fmt.Sprintf("rig %s: log_tail: bad path %q", addr, lc.Path))
+			}
+			if _, err := compileLogEvents(lc.Events); err != nil {
+				problems = append(problems, fmt.Sprintf("rig %s: log_tail: %v", addr, err))
+			}
+		}
+		if conf.protoFor(addr) == "exec" && len(rc.Command) == 0 {
+			problems = append(problems, fmt.Sprintf("rig %s: proto exec needs a command", addr))
+		}
+		if rc.Plug != nil {
+			switch rc.Plug.Type {
+			case "tasmota", "shelly", "kasa":
+			default:
+				problems = append(problems, fmt.Sprintf("rig %s: unknown plug type %q", addr, rc.Plug.Type))
+			}
+			if len(rc.Plug.Addr) == 0 {
+				problems = append(problems, fmt.Sprintf("rig %s: plug has no addr", addr))
+			}
+		}
+		if rc.Redfish != nil && len(rc.Redfish.URL) == 0 {
+			problems = append(problems, fmt.Sprintf("rig %s: redfish has no url", addr))
+		}
+		if s := rc.GPUSensors; s != nil {
+			if !gpuSensorTypes[s.Type] {
+				problems = append(problems, fmt.Sprintf("rig %s: unknown gpu_sensors type %q", addr, s.Type))
+			}
+			if s.Type == "http" && len(s.URL) == 0 {
+				problems = append(problems, fmt.Sprintf("rig %s: gpu_sensors has no url", addr))
+			}
+			mapped := make(map[int]int)
+			for gpu, index := range s.Indexes {
+				if _, err := strconv.Atoi(gpu); err != nil || index < 0 {
+					problems = append(problems, fmt.Sprintf("rig %s: bad gpu_sensors indexes entry %q: %d", addr, gpu, index))
+				}
+				if mapped[index]++; mapped[index] == 2 {
+					problems = append(problems, fmt.Sprintf("rig %s: gpu_sensors indexes map several GPUs to %d", addr, index))
+				}
+			}
+		}
+		if rc.ShareDifficulty < 0 {
+			problems = append(problems, fmt.Sprintf("rig %s: negative share_difficulty", addr))
+		}
+		if rc.TempLimit < 0 {
+			problems = append(problems, fmt.Sprintf("rig %s: negative temp_limit", addr))
+		}
+		for gpu, limit := range rc.GPUTempLimits {
+			if _, err := strconv.Atoi(gpu); err != nil || limit < 0 {
+				problems = append(problems, fmt.Sprintf("rig %s: bad gpu_temp_limits entry %q: %v", addr, gpu, limit))
+			}
+		}
+		if _, ok := conf.File.Groups[rc.Group]; len(rc.Group) != 0 && !ok {
+			problems = append(problems, fmt.Sprintf("rig %s: unknown group %q", addr, rc.Group))
+		}
+		if d, err := time.ParseDuration(rc.PollInterval); len(rc.PollInterval) != 0 && (err != nil || d <= 0) {
+			problems = append(problems, fmt.Sprintf("rig %s: bad poll_interval %q", addr, rc.PollInterval))
+		}
+		for _, p := range badTimeouts(rc.DialTimeout, rc.RPCTimeout, rc.EmitTimeout) {
+			problems = append(problems, fmt.Sprintf("rig %s: %s", addr, p))
+		}
+	}
+	if auth := conf.File.Auth; auth != nil {
+		for i, t := range auth.Tokens {
+			if len(t.Token) == 0 {
+				problems = append(problems, fmt.Sprintf("auth token %d (%s): empty token", i, t.Name))
+			}
+			if !validScope(t.Scope) {
+				problems = append(problems, fmt.Sprintf("auth token %d (%s): unknown scope %q", i, t.Name, t.Scope))
+			}
+		}
+		for cn, scope := range auth.Clients {
+			if !validScope(scope) {
+				problems = append(problems, fmt.Sprintf("auth client %s: unknown scope %q", cn, scope))
+			}
+		}
+		if p := auth.Proxy; p != nil {
+			if len(p.TrustedProxies) == 0 {
+				problems = append(problems, "auth proxy: no trusted_proxies, the user header is never accepted")
+			}
+			for _, cidr := range p.TrustedProxies {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					problems = append(problems, fmt.Sprintf("auth proxy: bad trusted proxy %q: %v", cidr, err))
+				}
+			}
+			for user, scope := range p.Users {
+				if !validScope(scope) {
+					problems = append(problems, fmt.Sprintf("auth proxy user %s: unknown scope %q", user, scope))
+				}
+			}
+			if len(p.DefaultScope) != 0 && !validScope(p.DefaultScope) {
+				problems = append(problems, fmt.Sprintf("auth proxy: unknown default_scope %q", p.DefaultScope))
+			}
+		}
+	}
+	if z := conf.File.Zabbix; z != nil {
+		for reading := range z.Keys {
+			if _, ok := zabbixReadings[reading]; !ok {
+				problems = append(problems, fmt.Sprintf("zabbix: unknown reading %q in keys", reading))
+			}
+		}
+	}
+	for coin, cc := range conf.File.Coins {
+		if len(cc.Wallets) != 0 && len(cc.NodeURL) == 0 {
+			problems = append(problems, fmt.Sprintf("coin %s: wallets without node_url", coin))
+		}
+		if cc.PoolAPI != nil && len(cc.PoolAPI.URL) != 0 && !strings.Contains(cc.PoolAPI.URL, "{wallet}") {
+			problems = append(problems, fmt.Sprintf("coin %s: pool_api url has no {wallet}", coin))
+		}
+		if cc.PoolAPI != nil && len(cc.PoolAPI.PayoutsURL) != 0 && !strings.Contains(cc.PoolAPI.PayoutsURL, "{wallet}") {
+			problems = append(problems, fmt.Sprintf("coin %s: pool_api payouts_url has no {wallet}", coin))
+		}
+	}
+	for i, hook := range conf.File.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("webhook %d: bad url %q", i, hook.URL))
+		}
+		for _, change := range hook.Changes {
+			if !webhookChanges[change] {
+				problems = append(problems, fmt.Sprintf("webhook %d: unknown change %q", i, change))
+			}
+		}
+	}
+	for name, gc := range conf.File.Groups {
+		if d, err := time.ParseDuration(gc.PollInterval); len(gc.PollInterval) != 0 && (err != nil || d <= 0) {
+			problems = append(problems, fmt.Sprintf("group %s: bad poll_interval %q", name, gc.PollInterval))
+		}
+		for _, p := range badTimeouts(gc.DialTimeout, gc.RPCTimeout, gc.EmitTimeout) {
+			problems = append(problems, fmt.Sprintf("group %s: %s", name, p))
+		}
+		if gc.Dialer != nil {
+			for _, p := range checkDialer(gc.Dialer) {
+				problems = append(problems, fmt.Sprintf("group %s: dialer: %s", name, p))
+			}
+		}
+	}
+	if conf.File.Dialer != nil {
+		for _, p := range checkDialer(conf.File.Dialer) {
+			problems = append(problems, "dialer: "+p)
+		}
+	}
+	for miner, mc := range conf.File.Miners {
+		if len(mc.Prefix) != 0 && !validPrefix.MatchString(mc.Prefix) {
+			problems = append(problems, fmt.Sprintf("miner %s: bad prefix %q", miner, mc.Prefix))
+		}
+	}
+	for addr, lc := range conf.File.Listeners {
+		if (len(lc.TLSCertFile) == 0) != (len(lc.TLSKeyFile) == 0) {
+			problems = append(problems, fmt.Sprintf("listener %s: tls_cert_file and tls_key_file go together", addr))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
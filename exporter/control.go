@@ -0,0 +1,164 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Claymore management methods. They are only accepted when the miner runs
+// with a writable API (positive -mport) and the matching -mpsw password.
+// miner_reboot makes Claymore run reboot.bat (reboot.bash on Linux) on the rig,
+// miner_restart restarts the miner process and control_gpu takes a GPU index
+// (-1 for all) and a state: 0 disabled, 1 primary coin only, 2 dual.
+const (
+	methodReboot  = "miner_reboot"
+	methodRestart = "miner_restart"
+	methodGPU     = "control_gpu"
+)
+
+type minerCommand struct {
+	ID      int      `json:"id"`
+	JSONRPC string   `json:"jsonrpc"`
+	Method  string   `json:"method"`
+	Params  []string `json:"params,omitempty"`
+	Psw     string   `json:"psw,omitempty"`
+}
+
+// errReadOnly is the error for commands to a rig whose API doesn't take
+// them, which would otherwise be silently ignored.
+func errReadOnly(rig string) error {
+	return fmt.Errorf("%s doesn't accept management commands: its API is read-only (negative -mport) or the password is wrong", rig)
+}
+
+// errNoAPI is the error for commands to a rig scraped with a command,
+// which has no miner API to send them to.
+func errNoAPI(rig string) error {
+	return fmt.Errorf("%s is scraped with a command and has no API for management commands", rig)
+}
+
+// sendMinerCommand writes a management command to the miner. Claymore does
+// not answer management commands, so a successful write is all we can check.
+// Commands go over JSON-RPC on the API port whatever protocol the rig is
+// scraped with; a rig scraped with a command has no API to send them to.
+func sendMinerCommand(addr string, conf *expConf, method string, params ...string) error {
+	if conf.protoFor(addr) == "exec" {
+		return errNoAPI(addr)
+	}
+	client, err := dialMiner(context.Background(), "tcp", addr, conf, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("dialing: %v", err)
+	}
+	defer client.Close()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	cmd := minerCommand{
+		ID:      0,
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		Psw:     conf.passwordFor(addr),
+	}
+	if err := json.NewEncoder(client).Encode(cmd); err != nil {
+		return fmt.Errorf("sending %s: %v", method, err)
+	}
+
+	return nil
+}
+
+func controlHandler(w http.ResponseWriter, r *http.Request, conf *expConf, rig, method string, params ...string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who, denied := requireScope(w, r, conf, scopeControl)
+	if len(denied) != 0 {
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: denied})
+		return
+	}
+
+	if conf.protoFor(rig) == "exec" {
+		err := errNoAPI(rig)
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditError, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run")
+	if dryRun == "1" || dryRun == "true" {
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditDryRun})
+		fmt.Fprintf(w, "dry run: would send %s to %s\n", method, rig)
+		return
+	}
+
+	now := time.Now()
+	writable, err := writeMode.probe(rig, conf, now)
+	if err != nil {
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditError, Error: err.Error()})
+		http.Error(w, fmt.Sprintf("can't reach %s: %v", rig, err), http.StatusBadGateway)
+		return
+	}
+	if !writable {
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditReadOnly})
+		http.Error(w, errReadOnly(rig).Error(), http.StatusConflict)
+		return
+	}
+
+	if guard.needsConfirm(method) {
+		token := r.URL.Query().Get("confirm")
+		if len(token) == 0 {
+			token = guard.newConfirm(who, rig, method, now)
+			audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditConfirmRequired})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"confirm": token,
+				"expires": now.Add(confirmTTL),
+			})
+			return
+		}
+		if !guard.useConfirm(token, who, rig, method, now) {
+			audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditBadConfirm})
+			http.Error(w, "unknown or expired confirmation", http.StatusConflict)
+			return
+		}
+	}
+
+	if ok, wait := guard.allow(rig, now); !ok {
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditRateLimited})
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "too many commands for "+rig, http.StatusTooManyRequests)
+		return
+	}
+
+	if err := sendMinerCommand(rig, conf, method, params...); err != nil {
+		audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditError, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	audit(r, auditEvent{Who: who, Action: method, Rig: rig, Params: params, Result: auditOK})
+	fmt.Fprintf(w, "sent %s to %s\n", method, rig)
+}
+
+// gpuControlHandler serves /api/v1/rigs/{rig}/gpu?index=N&state=S, see
+// methodGPU.
+func gpuControlHandler(w http.ResponseWriter, r *http.Request, conf *expConf, rig string) {
+	index, err := strconv.Atoi(r.URL.Query().Get("index"))
+	if err != nil || index < -1 {
+		http.Error(w, "bad or missing index, want a GPU index or -1 for all", http.StatusBadRequest)
+		return
+	}
+	state, err := strconv.Atoi(r.URL.Query().Get("state"))
+	if err != nil || state < 0 || state > 2 {
+		http.Error(w, "bad or missing state, want 0, 1 or 2", http.StatusBadRequest)
+		return
+	}
+	controlHandler(w, r, conf, rig, methodGPU, strconv.Itoa(index), strconv.Itoa(state))
+}
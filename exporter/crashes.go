@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var gpuCrashesDesc = prometheus.NewDesc(
+	"claymore_gpu_crash_events_total",
+	"Times the GPU's hashrate dropped from non-zero to zero while the miner kept running",
+	[]string{"Rig", "GPU"},
+	nil)
+
+// gpuCrashState is what crash detection remembers of a rig between scrapes.
+type gpuCrashState struct {
+	uptime  float64
+	rates   map[string]float64
+	crashes map[string]float64
+}
+
+// crashMetrics counts the rig's GPUs whose hashrate fell to zero since the
+// last reply. A restarted miner (lower uptime) starts from scratch instead,
+// so a whole rig restarting doesn't count as every card crashing. GPUs
+// turned off in the miner aren't crashes either.
+func (c *ClaymoreStatsCollector) crashMetrics(addr string, stats *claymore.Stats) []prometheus.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, ok := c.crashes[addr]
+	if !ok {
+		st = &gpuCrashState{crashes: make(map[string]float64)}
+		c.crashes[addr] = st
+	}
+
+	uptime, _ := strconv.ParseFloat(stats.Uptime, 64)
+	restarted := uptime < st.uptime
+	rates := make(map[string]float64)
+	for _, gpu := range stats.GPUs {
+		// A hashrate dropped by the sanity checks is unknown, not 0.
+		if !gpu.Enabled || len(gpu.HashRate) == 0 {
+			continue
+		}
+		rate, _ := strconv.ParseFloat(gpu.HashRate, 64)
+		rates[gpu.Name] = rate
+		if _, seen := st.crashes[gpu.Name]; !seen {
+			st.crashes[gpu.Name] = 0
+		}
+		if !restarted && rate == 0 && st.rates[gpu.Name] > 0 {
+			st.crashes[gpu.Name]++
+			events.alert(addr, gpu.Name, alertGPUCrash, 0, 0)
+			c.noteIncident(addr, gpu.Name, alertGPUCrash)
+		}
+	}
+	st.uptime = uptime
+	st.rates = rates
+
+	var metrics []prometheus.Metric
+	for gpu, n := range st.crashes {
+		metrics = append(metrics, prometheus.MustNewConstMetric(gpuCrashesDesc,
+			prometheus.CounterValue,
+			n,
+			addr, gpu))
+	}
+	return metrics
+}
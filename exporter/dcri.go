@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var gpuDualIntensityDesc = prometheus.NewDesc(
+	"claymore_gpu_dual_intensity",
+	"Dual coin intensity (-dcri) of the GPU, from the miner's config.txt",
+	[]string{"Rig", "GPU"},
+	nil)
+
+// methodGetFile reads a file from the miner's directory. Claymore answers
+// with the file name and its contents hex encoded; like the management
+// methods it needs a writable API.
+const methodGetFile = "miner_getfile"
+
+// dcriRefresh is how often a rig's config.txt is read again.
+const dcriRefresh = 10 * time.Minute
+
+// rigDcri is a rig's -dcri setting and when it was read.
+type rigDcri struct {
+	values []string
+	time   time.Time
+}
+
+// readMinerFile fetches a file from the miner's directory.
+func readMinerFile(addr string, conf *expConf, name string) ([]byte, error) {
+	timeouts := conf.timeouts(addr)
+	client, err := dialMiner(context.Background(), "tcp", addr, conf, timeouts.dial)
+	if err != nil {
+		return nil, fmt.Errorf("dialing: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(timeouts.rpc))
+
+	req := minerCommand{ID: 0, JSONRPC: "2.0", Method: methodGetFile, Params: []string{name}, Psw: conf.passwordFor(addr)}
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		return nil, fmt.Errorf("sending %s: %v", methodGetFile, err)
+	}
+	line, err := bufio.NewReader(limitConn(client)).ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, fmt.Errorf("reading reply: %v", err)
+	}
+	raw, err := decodeRawReply(line)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	if err := json.Unmarshal(*raw, &result); err != nil || len(result) < 2 {
+		return nil, fmt.Errorf("unexpected %s reply: %s", methodGetFile, *raw)
+	}
+	return hex.DecodeString(result[1])
+}
+
+// parseDcri returns the -dcri values of a Claymore config.txt, one per GPU
+// or a single one for all of them, or nil if it has none.
+func parseDcri(config string) []string {
+	for _, line := range strings.Split(config, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "-dcri" {
+				return strings.Split(fields[i+1], ",")
+			}
+		}
+	}
+	return nil
+}
+
+// dualIntensity returns the rig's -dcri values, read from its config.txt at
+// most every dcriRefresh. A failed read keeps the previous values.
+func (c *ClaymoreStatsCollector) dualIntensity(addr string, conf *expConf, now time.Time) []string {
+	c.mu.Lock()
+	d, ok := c.dualIntensities[addr]
+	c.mu.Unlock()
+	if ok && now.Sub(d.time) < dcriRefresh {
+		return d.values
+	}
+
+	d.time = now
+	config, err := readMinerFile(addr, conf, "config.txt")
+	if err != nil {
+		log.Printf("Reading config.txt of %s: %v", addr, err)
+	} else {
+		d.values = parseDcri(string(config))
+	}
+	c.mu.Lock()
+	c.dualIntensities[addr] = d
+	c.mu.Unlock()
+	return d.values
+}
+
+// dualIntensityMetrics exports the -dcri of the rig's GPUs that mine dual.
+func (c *ClaymoreStatsCollector) dualIntensityMetrics(addr string, conf *expConf, stats *claymore.Stats, now time.Time) []prometheus.Metric {
+	values := c.dualIntensity(addr, conf, now)
+	if len(values) == 0 {
+		return nil
+	}
+
+	var metrics []prometheus.Metric
+	for i, gpu := range stats.GPUs {
+		if gpuMode(gpu) != "dual" {
+			continue
+		}
+		v := values[0]
+		if len(values) > 1 {
+			v = claymore.At(values, i)
+		}
+		dcri, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(gpuDualIntensityDesc,
+			prometheus.GaugeValue,
+			dcri,
+			addr, gpu.Name))
+	}
+	return metrics
+}
@@ -0,0 +1,226 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// dialerConf tunes the connections to the miners, e.g. to leave through
+// the NIC on the miners' VLAN on a multi-homed exporter host.
+type dialerConf struct {
+	// KeepAlive is the TCP keepalive interval, e.g. "30s"; "-1s" turns
+	// keepalives off. Go's default of 15s applies when it is empty.
+	KeepAlive string `json:"keepalive"`
+	// Linger is SO_LINGER in seconds: 0 resets the connection on close
+	// instead of leaving it in TIME_WAIT. Unset keeps the OS default.
+	Linger *int `json:"linger"`
+	// SourceIP is the local address to connect from.
+	SourceIP string `json:"source_ip"`
+	// SourceInterface connects from the first address of this interface,
+	// e.g. "eth1", of the same IP version as the miner's where it has one.
+	SourceInterface string `json:"source_interface"`
+	// HappyEyeballs races the addresses of a hostname resolving to
+	// several, instead of trying them one after the other.
+	HappyEyeballs bool `json:"happy_eyeballs"`
+}
+
+// dialerFor returns the dialer tuning of the rig: its group's, the file's
+// top-level one, or none.
+func (c *expConf) dialerFor(addr string) *dialerConf {
+	if c.File == nil {
+		return nil
+	}
+	if dc := c.group(c.rig(addr).Group).Dialer; dc != nil {
+		return dc
+	}
+	return c.File.Dialer
+}
+
+// sourceAddr returns the local address to dial host from, nil for any.
+func (dc *dialerConf) sourceAddr(host string) (net.Addr, error) {
+	if len(dc.SourceIP) != 0 {
+		ip := net.ParseIP(dc.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("bad source_ip %q", dc.SourceIP)
+		}
+		return &net.TCPAddr{IP: ip}, nil
+	}
+	if len(dc.SourceInterface) == 0 {
+		return nil, nil
+	}
+	iface, err := net.InterfaceByName(dc.SourceInterface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	wantV4 := true
+	if ip := net.ParseIP(host); ip != nil {
+		wantV4 = ip.To4() != nil
+	}
+	var first net.IP
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipnet.IP.To4() != nil) == wantV4 {
+			return &net.TCPAddr{IP: ipnet.IP}, nil
+		}
+		if first == nil {
+			first = ipnet.IP
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("interface %s has no address", dc.SourceInterface)
+	}
+	return &net.TCPAddr{IP: first}, nil
+}
+
+// happyEyeballsDelay is how long a raced dial waits for an address before
+// also trying the next, as recommended by RFC 8305.
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// dialMiner connects to the rig's miner over network with the rig's dialer
+// tuning. A hostname resolving to several addresses has them tried in the
+// resolver's order, each with an equal share of timeout, or raced with
+// happy_eyeballs.
+func dialMiner(ctx context.Context, network, addr string, conf *expConf, timeout time.Duration) (net.Conn, error) {
+	host, port := splitTarget(addr, conf.Port)
+	ips := hosts.lookupAll(host)
+	if len(ips) == 0 {
+		ips = []string{host}
+	}
+	targets := make([]string, len(ips))
+	for i, ip := range ips {
+		targets[i] = net.JoinHostPort(ip, port)
+	}
+
+	d := net.Dialer{Timeout: timeout}
+	dc := conf.dialerFor(addr)
+	if dc != nil {
+		if ka, err := time.ParseDuration(dc.KeepAlive); err == nil {
+			d.KeepAlive = ka
+		}
+		src, err := dc.sourceAddr(host)
+		if err != nil {
+			return nil, err
+		}
+		if src != nil {
+			d.LocalAddr = src
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if len(targets) > 1 && dc != nil && dc.HappyEyeballs {
+		conn, err = raceDial(ctx, d, network, targets)
+	} else {
+		d.Timeout = timeout / time.Duration(len(targets))
+		for _, target := range targets {
+			if conn, err = d.DialContext(ctx, network, target); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := conn.(*net.TCPConn); ok && dc != nil && dc.Linger != nil {
+		tc.SetLinger(*dc.Linger)
+	}
+	return conn, nil
+}
+
+// raceDial starts dialing the next target whenever the previous one failed
+// or hasn't connected within happyEyeballsDelay, and returns the first
+// connection made. The others are closed.
+func raceDial(ctx context.Context, d net.Dialer, network string, targets []string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	d.Timeout = 0
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(targets))
+	started, failed := 0, 0
+	var firstErr error
+	next := time.NewTimer(0)
+	defer next.Stop()
+	for {
+		select {
+		case <-next.C:
+			go func(target string) {
+				conn, err := d.DialContext(ctx, network, target)
+				results <- result{conn, err}
+			}(targets[started])
+			started++
+			if started < len(targets) {
+				next.Reset(happyEyeballsDelay)
+			}
+		case r := <-results:
+			if r.err == nil {
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(started - failed - 1)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			failed++
+			if failed == len(targets) {
+				return nil, firstErr
+			}
+			if failed == started {
+				// Nothing in flight, no need to wait for the delay.
+				if !next.Stop() {
+					select {
+					case <-next.C:
+					default:
+					}
+				}
+				next.Reset(0)
+			}
+		}
+	}
+}
+
+// remoteIP returns the address a connection reached, without the port.
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// checkDialer lists the problems of a dialer section.
+func checkDialer(dc *dialerConf) []string {
+	var problems []string
+	if _, err := time.ParseDuration(dc.KeepAlive); len(dc.KeepAlive) != 0 && err != nil {
+		problems = append(problems, fmt.Sprintf("bad keepalive %q", dc.KeepAlive))
+	}
+	if len(dc.SourceIP) != 0 && net.ParseIP(dc.SourceIP) == nil {
+		problems = append(problems, fmt.Sprintf("bad source_ip %q", dc.SourceIP))
+	}
+	if len(dc.SourceIP) != 0 && len(dc.SourceInterface) != 0 {
+		problems = append(problems, "source_ip and source_interface are exclusive")
+	}
+	if len(dc.SourceInterface) != 0 {
+		if _, err := net.InterfaceByName(dc.SourceInterface); err != nil {
+			problems = append(problems, fmt.Sprintf("source_interface: %v", err))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package exporter
+
+import (
+	"errors"
+	"log/slog"
+)
+
+type eventLog struct{}
+
+func openEventLog() (*eventLog, error) {
+	return nil, errors.New("only available on Windows")
+}
+
+func (e *eventLog) writeLevel(level slog.Level, msg []byte) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package exporter
+
+import (
+	"log/slog"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventSource is the Event Log source the exporter logs as.
+const eventSource = "claymore_exporter"
+
+// eventLog writes to the Windows Application log, as errors, warnings or
+// information events.
+type eventLog struct {
+	log *eventlog.Log
+}
+
+func openEventLog() (*eventLog, error) {
+	// Registering the source needs administrator rights and only has to
+	// happen once, so failing here is fine if it already exists.
+	eventlog.InstallAsEventCreate(eventSource, eventlog.Error|eventlog.Warning|eventlog.Info)
+	l, err := eventlog.Open(eventSource)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{log: l}, nil
+}
+
+func (e *eventLog) writeLevel(level slog.Level, msg []byte) error {
+	switch {
+	case level >= slog.LevelError:
+		return e.log.Error(1, string(msg))
+	case level >= slog.LevelWarn:
+		return e.log.Warning(1, string(msg))
+	}
+	return e.log.Info(1, string(msg))
+}
@@ -0,0 +1,133 @@
+package exporter
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// event is a JSON message published to Kafka, NATS or Loki: a poll
+// result, an alert the exporter detected itself, a state change posted to
+// webhooks or an event matched in a miner's log.
+type event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Rig  string    `json:"rig"`
+	// Poll results.
+	Up     *bool          `json:"up,omitempty"`
+	Sample *historySample `json:"sample,omitempty"`
+	// Alerts.
+	Alert string  `json:"alert,omitempty"`
+	GPU   string  `json:"gpu,omitempty"`
+	Value float64 `json:"value,omitempty"`
+	Limit float64 `json:"limit,omitempty"`
+	// State changes, with GPU and the rig's GPU count for GPU changes.
+	Change string `json:"change,omitempty"`
+	GPUs   int    `json:"gpus,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	// Log events, with GPU if the pattern names one.
+	Event string `json:"event,omitempty"`
+	Line  string `json:"line,omitempty"`
+}
+
+// Alerts published as events. The rig alerts need the poller; crashes and
+// temperature limits are detected on every scrape.
+const (
+	alertRigDown          = "rig_down"
+	alertRigUp            = "rig_up"
+	alertGPUCrash         = "gpu_crash"
+	alertGPUOvertemp      = "gpu_overtemp"
+	alertGPUOvertempEnded = "gpu_overtemp_resolved"
+)
+
+// eventPublisher delivers messages to a broker, keyed by rig.
+type eventPublisher interface {
+	publish(key string, msg []byte) error
+	String() string
+}
+
+// eventQueueSize is how many events wait for a slow broker before new
+// ones are dropped.
+const eventQueueSize = 1000
+
+// eventBus queues events for the publishers, so a slow or unreachable
+// broker never holds up a scrape. It is also the poller sink for poll
+// results.
+type eventBus struct {
+	publishers []eventPublisher
+	queue      chan event
+
+	mu sync.Mutex
+	up map[string]bool
+}
+
+// events is the event bus, nil unless publishing is configured.
+var events *eventBus
+
+func newEventBus(publishers []eventPublisher) *eventBus {
+	b := &eventBus{publishers: publishers, queue: make(chan event, eventQueueSize), up: make(map[string]bool)}
+	go b.run()
+	return b
+}
+
+func (b *eventBus) run() {
+	for e := range b.queue {
+		msg, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("Encoding %s event: %v", e.Type, err)
+			continue
+		}
+		for _, p := range b.publishers {
+			if err := p.publish(e.Rig, msg); err != nil {
+				log.Printf("Publishing %s event of %s to %s: %v", e.Type, e.Rig, p, err)
+			}
+		}
+	}
+}
+
+// send queues e, dropping it if the queue is full.
+func (b *eventBus) send(e event) {
+	if b == nil {
+		return
+	}
+	select {
+	case b.queue <- e:
+	default:
+		log.Printf("Event queue full, dropping %s event of %s", e.Type, e.Rig)
+	}
+}
+
+// alert publishes an alert about the rig, and its GPU if gpu isn't empty,
+// unless the rig is in maintenance or the alert is silenced.
+func (b *eventBus) alert(rig, gpu, alert string, value, limit float64) {
+	if b == nil || suppressed(rig, alert) {
+		return
+	}
+	b.send(event{Type: "alert", Time: time.Now(), Rig: rig, Alert: alert, GPU: gpu, Value: value, Limit: limit})
+}
+
+func (b *eventBus) String() string { return "the event bus" }
+
+// emit publishes a poll result, and rig_down or rig_up when the rig's up
+// state changed since the last poll.
+func (b *eventBus) emit(rig string, up bool, s historySample) error {
+	e := event{Type: "poll", Time: time.Now(), Rig: rig, Up: &up}
+	if up {
+		e.Sample = &s
+	}
+	b.send(e)
+
+	b.mu.Lock()
+	was, seen := b.up[rig]
+	b.up[rig] = up
+	b.mu.Unlock()
+	switch {
+	case (!seen || was) && !up:
+		b.alert(rig, "", alertRigDown, 0, 0)
+	case seen && !was && up:
+		b.alert(rig, "", alertRigUp, 0, 0)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	execSuccessDesc = prometheus.NewDesc(
+		"claymore_exec_success",
+		"1 if the rig's exec command ran and its output parsed",
+		[]string{"Rig", "source"},
+		nil)
+
+	execDurationDesc = prometheus.NewDesc(
+		"claymore_exec_duration_seconds",
+		"How long the rig's exec command ran",
+		[]string{"Rig", "source"},
+		nil)
+)
+
+// execConf is a command run on every scrape of the rig whose output, JSON
+// or the Prometheus text format, becomes metrics of the rig.
+type execConf struct {
+	// Name is the source label, the command's base name by default.
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	// Format is json or prom; by default output starting with { or [ is
+	// JSON.
+	Format string `json:"format"`
+	// Timeout bounds the command, 10s by default.
+	Timeout string `json:"timeout"`
+}
+
+// execMaxOutput is --exec.max-output, the most a command may print.
+var execMaxOutput = 1 << 20
+
+const defaultExecTimeout = 10 * time.Second
+
+// errOutputLimit is returned for a command printing more than
+// execMaxOutput.
+var errOutputLimit = errors.New("output limit exceeded")
+
+// limitedBuffer keeps up to max bytes and fails writes past that, which
+// stops the copy from the command. The buffer isn't embedded, its
+// ReadFrom would bypass the limit.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		b.exceeded = true
+		return 0, errOutputLimit
+	}
+	return b.buf.Write(p)
+}
+
+// runCommand runs args with extra environment and returns its stdout, at
+// most execMaxOutput of it.
+func runCommand(ctx context.Context, args []string, env ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	stdout := &limitedBuffer{max: execMaxOutput}
+	stderr := &limitedBuffer{max: 4096}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("running %s: %w", args[0], ctx.Err())
+	case stdout.exceeded:
+		return nil, fmt.Errorf("running %s: more than %d bytes of output", args[0], execMaxOutput)
+	case err != nil:
+		return nil, fmt.Errorf("running %s: %v: %s", args[0], err, strings.TrimSpace(stderr.buf.String()))
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// execMetrics runs the command and exports its output as the rig's
+// metrics, plus whether and how long it ran.
+func execMetrics(addr string, conf *expConf, ec execConf, seen map[string]bool) []prometheus.Metric {
+	if len(ec.Command) == 0 {
+		return nil
+	}
+	source := ec.Name
+	if len(source) == 0 {
+		source = ec.Command[0][strings.LastIndex(ec.Command[0], "/")+1:]
+	}
+	timeout := defaultExecTimeout
+	if d, err := time.ParseDuration(ec.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	args := make([]string, len(ec.Command))
+	for i, arg := range ec.Command {
+		args[i] = strings.Replace(arg, "{rig}", addr, -1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	out, err := runCommand(ctx, args, "CLAYMORE_RIG="+addr)
+	duration := time.Since(start)
+
+	var samples []extraSample
+	if err == nil {
+		out = bytes.TrimSpace(out)
+		format := ec.Format
+		if len(format) == 0 {
+			format = "prom"
+			if len(out) != 0 && (out[0] == '{' || out[0] == '[') {
+				format = "json"
+			}
+		}
+		if format == "json" {
+			samples, err = parseExtraJSON(out)
+		} else {
+			// The text format ends with a newline.
+			samples, err = parseExtraProm(bytes.NewReader(append(out, '\n')))
+		}
+	}
+	if err != nil {
+		log.Printf("Exec %s of %s: %v", source, addr, err)
+	}
+
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(execSuccessDesc,
+			prometheus.GaugeValue,
+			boolValue(err == nil),
+			addr, source),
+		prometheus.MustNewConstMetric(execDurationDesc,
+			prometheus.GaugeValue,
+			duration.Seconds(),
+			addr, source),
+	}
+	return append(metrics, sampleMetrics(addr, source, samples, seen)...)
+}
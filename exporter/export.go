@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportRow is one flattened history sample. Rig-level rows leave GPU
+// empty, GPU rows leave the share and uptime columns at zero.
+type exportRow struct {
+	Time     int64   `json:"time"`
+	Rig      string  `json:"rig"`
+	GPU      string  `json:"gpu"`
+	HashRate float64 `json:"hashrate"`
+	Temp     float64 `json:"temp"`
+	FanSpeed float64 `json:"fanspeed"`
+	Shares   float64 `json:"shares"`
+	Rejected float64 `json:"rejected"`
+	Uptime   float64 `json:"uptime"`
+}
+
+var exportHeader = []string{"time", "rig", "gpu", "hashrate", "temp", "fanspeed", "shares", "rejected", "uptime"}
+
+func (r exportRow) record() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		time.Unix(r.Time, 0).UTC().Format(time.RFC3339),
+		r.Rig,
+		r.GPU,
+		f(r.HashRate),
+		f(r.Temp),
+		f(r.FanSpeed),
+		f(r.Shares),
+		f(r.Rejected),
+		f(r.Uptime),
+	}
+}
+
+func exportRows(h *history, rigs []string, since time.Time) []exportRow {
+	rows := []exportRow{}
+	for _, rig := range rigs {
+		for _, s := range h.query(rig, since) {
+			rows = append(rows, exportRow{
+				Time:     s.Time.Unix(),
+				Rig:      rig,
+				HashRate: s.TotalRate,
+				Shares:   s.EthFound,
+				Rejected: s.EthReject,
+				Uptime:   s.Uptime,
+			})
+			for _, g := range s.GPUs {
+				rows = append(rows, exportRow{
+					Time:     s.Time.Unix(),
+					Rig:      rig,
+					GPU:      g.Name,
+					HashRate: g.HashRate,
+					Temp:     g.Temp,
+					FanSpeed: g.FanSpeed,
+				})
+			}
+		}
+	}
+	return rows
+}
+
+// exportHandler serves /api/v1/export?range=24h&format=csv|json.
+func exportHandler(h *history) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h == nil {
+			http.Error(w, "history is disabled", http.StatusNotFound)
+			return
+		}
+
+		q := r.URL.Query()
+		rng := 24 * time.Hour
+		if len(q.Get("range")) != 0 {
+			d, err := time.ParseDuration(q.Get("range"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("bad range: %v", err), http.StatusBadRequest)
+				return
+			}
+			rng = d
+		}
+
+		conf := currentConf()
+		rows := exportRows(h, conf.Dial_Addr, time.Now().Add(-rng))
+
+		switch q.Get("format") {
+		case "", "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="claymore_history.csv"`)
+			cw := csv.NewWriter(w)
+			cw.Write(exportHeader)
+			for _, row := range rows {
+				cw.Write(row.record())
+			}
+			cw.Flush()
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rows)
+		default:
+			http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// extraPrefix keeps metrics read from files apart from the exporter's own,
+// whose help strings and types a same-named metric would clash with.
+const extraPrefix = "claymore_extra_"
+
+var extraModifiedDesc = prometheus.NewDesc(
+	"claymore_extra_source_modified_timestamp_seconds",
+	"When the file extra metrics are read from was last written",
+	[]string{"Rig", "source"},
+	nil)
+
+var (
+	badNameChars  = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	badLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// extraSample is one metric read from a file.
+type extraSample struct {
+	Name    string            `json:"name"`
+	Value   float64           `json:"value"`
+	Labels  map[string]string `json:"labels"`
+	Counter bool              `json:"counter"`
+}
+
+// parseExtraProm reads the Prometheus text format, as written for
+// node_exporter's textfile collector. Summaries and histograms are skipped.
+func parseExtraProm(r io.Reader) ([]extraSample, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []extraSample
+	for name, mf := range families {
+		for _, m := range mf.Metric {
+			s := extraSample{Name: name, Labels: make(map[string]string)}
+			for _, l := range m.Label {
+				s.Labels[l.GetName()] = l.GetValue()
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				s.Value, s.Counter = m.GetCounter().GetValue(), true
+			case dto.MetricType_GAUGE:
+				s.Value = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				s.Value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			samples = append(samples, s)
+		}
+	}
+	return samples, nil
+}
+
+// parseExtraJSON reads either an object of names and numbers,
+// {"psu_watts": 812}, or an array of samples,
+// [{"name": "psu_watts", "value": 812, "labels": {"psu": "0"}}].
+func parseExtraJSON(data []byte) ([]extraSample, error) {
+	var samples []extraSample
+	if err := json.Unmarshal(data, &samples); err == nil {
+		return samples, nil
+	}
+	var values map[string]float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("want an object of numbers or an array of samples")
+	}
+	for name, v := range values {
+		samples = append(samples, extraSample{Name: name, Value: v})
+	}
+	return samples, nil
+}
+
+// readExtraFile reads a .json or Prometheus text file.
+func readExtraFile(path string) ([]extraSample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".json") {
+		return parseExtraJSON(data)
+	}
+	return parseExtraProm(bytes.NewReader(data))
+}
+
+// sanitizeLabel replaces the characters Prometheus doesn't allow in a
+// label name with underscores; a name starting with a digit gets one in
+// front.
+func sanitizeLabel(name string) string {
+	name = badLabelChars.ReplaceAllString(name, "_")
+	if len(name) != 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// extraMetrics exports the metrics scripts on the rig write to the rig's
+// extra_metrics files, with the exporter running on the rig, and those its
+// exec commands print. Each gets the claymore_extra_ prefix, the Rig label
+// and the file's or command's name as source; labels by those names in the
+// output are dropped.
+func extraMetrics(addr string, conf *expConf) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	seen := make(map[string]bool)
+	rc := conf.rig(addr)
+	for _, path := range rc.ExtraMetrics {
+		source := filepath.Base(path)
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Reading extra metrics of %s: %v", addr, err)
+			continue
+		}
+		samples, err := readExtraFile(path)
+		if err != nil {
+			log.Printf("Reading extra metrics of %s from %s: %v", addr, path, err)
+			continue
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(extraModifiedDesc,
+			prometheus.GaugeValue,
+			float64(fi.ModTime().UnixNano())/1e9,
+			addr, source))
+		metrics = append(metrics, sampleMetrics(addr, source, samples, seen)...)
+	}
+	for _, ec := range rc.Exec {
+		metrics = append(metrics, execMetrics(addr, conf, ec, seen)...)
+	}
+	return metrics
+}
+
+// sampleMetrics turns the samples of one source into metrics. seen holds
+// the series already exported for the rig: a series listed twice, in one
+// source or across them, would fail the whole scrape.
+func sampleMetrics(addr, source string, samples []extraSample, seen map[string]bool) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, s := range samples {
+		// The prefix makes any sanitized name valid.
+		name := badNameChars.ReplaceAllString(s.Name, "_")
+		if len(name) == 0 || extraPrefix+name == "claymore_extra_source_modified_timestamp_seconds" {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for k, v := range s.Labels {
+			k = sanitizeLabel(k)
+			if len(k) == 0 || k == "Rig" || k == "source" || strings.HasPrefix(k, "__") {
+				continue
+			}
+			labels[k] = v
+		}
+		labels["Rig"], labels["source"] = addr, source
+
+		key := name
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, k := range names {
+			values[i] = labels[k]
+			key += "\xff" + k + "\xff" + labels[k]
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		valueType, help := prometheus.GaugeValue, "Gauge read from a file or command on the rig"
+		if s.Counter {
+			valueType, help = prometheus.CounterValue, "Counter read from a file or command on the rig"
+		}
+		desc := prometheus.NewDesc(extraPrefix+name, help, names, nil)
+		m, err := prometheus.NewConstMetric(desc, valueType, s.Value, values...)
+		if err != nil {
+			log.Printf("Extra metric %s of %s: %v", name, addr, err)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
@@ -0,0 +1,374 @@
+package exporter
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gpuMemTempDesc = prometheus.NewDesc(
+		"claymore_gpu_mem_temp_celsius",
+		"GPU memory temperature from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuHotspotTempDesc = prometheus.NewDesc(
+		"claymore_gpu_hotspot_temp_celsius",
+		"GPU hotspot (junction) temperature from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuCoreClockDesc = prometheus.NewDesc(
+		"claymore_gpu_core_clock_hertz",
+		"GPU core clock from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuMemClockDesc = prometheus.NewDesc(
+		"claymore_gpu_mem_clock_hertz",
+		"GPU memory clock from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuPowerDesc = prometheus.NewDesc(
+		"claymore_gpu_power_watts",
+		"GPU power draw from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuPowerLimitDesc = prometheus.NewDesc(
+		"claymore_gpu_power_limit_watts",
+		"GPU power limit from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuEfficiencyDesc = prometheus.NewDesc(
+		"claymore_gpu_efficiency_hashes_per_joule",
+		"GPU hashrate divided by its power draw from the rig's GPU sensor backend",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuOCProfileDesc = prometheus.NewDesc(
+		"claymore_gpu_oc_profile_info",
+		"Overclocking profile the GPU is configured to run with",
+		[]string{"Rig", "GPU", "profile"},
+		nil)
+)
+
+// gpuSensorsConf is where a rig's memory and hotspot temperatures, clocks
+// and power limits come from, which Claymore's API doesn't report.
+// nvidia-smi and rocm-smi run on the exporter's host, so they only fit an
+// exporter running on the rig.
+type gpuSensorsConf struct {
+	// Type is nvidia-smi, rocm-smi or http.
+	Type string `json:"type"`
+	// URL is the http backend's JSON endpoint, e.g. a miner's API.
+	URL string `json:"url"`
+	// GPUs is the dotted path of the http reply's array of GPUs, "gpus"
+	// by default. The other fields name the GPU fields holding the miner's
+	// GPU index, the temperatures, the clocks in MHz and the power draw and
+	// limit in W; without Index the array's order is used.
+	GPUs        *string `json:"gpus"`
+	Index       string  `json:"index"`
+	MemTemp     string  `json:"mem_temp"`
+	HotspotTemp string  `json:"hotspot_temp"`
+	CoreClock   string  `json:"core_clock"`
+	MemClock    string  `json:"mem_clock"`
+	Power       string  `json:"power"`
+	PowerLimit  string  `json:"power_limit"`
+	// Indexes maps the miner's GPU indexes to the backend's where the two
+	// number the cards differently, e.g. {"0": 2, "2": 0} when Claymore
+	// and nvidia-smi disagree on the first and third card. GPUs without an
+	// entry keep their index.
+	Indexes map[string]int `json:"indexes"`
+}
+
+// gpuSensorTypes are the known gpuSensorsConf types.
+var gpuSensorTypes = map[string]bool{"nvidia-smi": true, "rocm-smi": true, "http": true}
+
+// gpuSensorTimeout bounds running a sensor tool or fetching from the URL.
+const gpuSensorTimeout = 5 * time.Second
+
+// gpuReadings holds what a backend reported for one GPU, nil where it has
+// nothing. Clocks are in MHz.
+type gpuReadings struct {
+	mem, hotspot        *float64
+	coreClock, memClock *float64
+	power, powerLimit   *float64
+}
+
+// sensorValue parses a reading, ignoring the "N/A" and "[N/A]" the tools
+// print for sensors a card doesn't have and rocm-smi's "(1750Mhz)" dressing.
+func sensorValue(s string) *float64 {
+	s = strings.TrimSuffix(strings.Trim(strings.TrimSpace(s), "()"), "Mhz")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+func runSensorTool(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gpuSensorTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// nvidiaSMIReadings reads memory temperatures, clocks and power draws and
+// limits with nvidia-smi. NVML only has memory temperatures for HBM cards, and no
+// hotspot at all.
+func nvidiaSMIReadings() (map[int]gpuReadings, error) {
+	out, err := runSensorTool("nvidia-smi", "--query-gpu=index,temperature.memory,clocks.sm,clocks.mem,power.limit,power.draw", "--format=csv,noheader,nounits")
+	if err != nil {
+		return nil, err
+	}
+	records, err := csv.NewReader(strings.NewReader(string(out))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	readings := make(map[int]gpuReadings)
+	for _, r := range records {
+		if len(r) < 6 {
+			continue
+		}
+		if i, err := strconv.Atoi(strings.TrimSpace(r[0])); err == nil {
+			readings[i] = gpuReadings{
+				mem:        sensorValue(r[1]),
+				coreClock:  sensorValue(r[2]),
+				memClock:   sensorValue(r[3]),
+				powerLimit: sensorValue(r[4]),
+				power:      sensorValue(r[5]),
+			}
+		}
+	}
+	return readings, nil
+}
+
+// gpuPowers keeps the power draws the rigs' sensor backends last reported,
+// by GPU name, for the history. Readings come after the sample is taken,
+// so a sample has the previous scrape's draws.
+type gpuPowers struct {
+	mu   sync.Mutex
+	rigs map[string]map[string]float64
+}
+
+var lastGPUPowers = &gpuPowers{rigs: make(map[string]map[string]float64)}
+
+// set replaces the rig's draws, forgetting them if there are none.
+func (p *gpuPowers) set(addr string, watts map[string]float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(watts) == 0 {
+		delete(p.rigs, addr)
+		return
+	}
+	p.rigs[addr] = watts
+}
+
+// addTo sets the power of the sample's GPUs.
+func (p *gpuPowers) addTo(addr string, s *historySample) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, g := range s.GPUs {
+		s.GPUs[i].Power = p.rigs[addr][g.Name]
+	}
+}
+
+var rocmCard = regexp.MustCompile(`^card(\d+)$`)
+
+// rocmSMIReadings reads memory and junction temperatures, clocks, power
+// draws and power caps with rocm-smi.
+func rocmSMIReadings() (map[int]gpuReadings, error) {
+	out, err := runSensorTool("rocm-smi", "--showtemp", "--showclocks", "--showpower", "--showmaxpower", "--json")
+	if err != nil {
+		return nil, err
+	}
+	var cards map[string]map[string]string
+	if err := json.Unmarshal(out, &cards); err != nil {
+		return nil, err
+	}
+	readings := make(map[int]gpuReadings)
+	for card, sensors := range cards {
+		m := rocmCard.FindStringSubmatch(card)
+		if m == nil {
+			continue
+		}
+		i, _ := strconv.Atoi(m[1])
+		readings[i] = gpuReadings{
+			mem:        sensorValue(sensors["Temperature (Sensor memory) (C)"]),
+			hotspot:    sensorValue(sensors["Temperature (Sensor junction) (C)"]),
+			coreClock:  sensorValue(sensors["sclk clock speed:"]),
+			memClock:   sensorValue(sensors["mclk clock speed:"]),
+			power:      sensorValue(sensors["Average Graphics Package Power (W)"]),
+			powerLimit: sensorValue(sensors["Max Graphics Package Power (W)"]),
+		}
+	}
+	return readings, nil
+}
+
+// httpSensorReadings reads the GPUs from a JSON endpoint.
+func httpSensorReadings(sc *gpuSensorsConf) (map[int]gpuReadings, error) {
+	var reply interface{}
+	if err := getJSON(sc.URL, &reply); err != nil {
+		return nil, err
+	}
+	path := "gpus"
+	if sc.GPUs != nil {
+		path = *sc.GPUs
+	}
+	gpus, err := jsonArray(reply, path)
+	if err != nil {
+		return nil, err
+	}
+
+	number := func(obj map[string]interface{}, field string) *float64 {
+		if v, ok := obj[field].(float64); ok && len(field) != 0 {
+			return &v
+		}
+		return nil
+	}
+	readings := make(map[int]gpuReadings)
+	for i, g := range gpus {
+		obj, _ := g.(map[string]interface{})
+		if len(sc.Index) != 0 {
+			index := number(obj, sc.Index)
+			if index == nil {
+				continue
+			}
+			i = int(*index)
+		}
+		readings[i] = gpuReadings{
+			mem:        number(obj, sc.MemTemp),
+			hotspot:    number(obj, sc.HotspotTemp),
+			coreClock:  number(obj, sc.CoreClock),
+			memClock:   number(obj, sc.MemClock),
+			power:      number(obj, sc.Power),
+			powerLimit: number(obj, sc.PowerLimit),
+		}
+	}
+	return readings, nil
+}
+
+// readGPUSensors returns the backend's readings by the miner's GPU index.
+func readGPUSensors(sc *gpuSensorsConf) (map[int]gpuReadings, error) {
+	var readings map[int]gpuReadings
+	var err error
+	switch sc.Type {
+	case "nvidia-smi":
+		readings, err = nvidiaSMIReadings()
+	case "rocm-smi":
+		readings, err = rocmSMIReadings()
+	case "http":
+		readings, err = httpSensorReadings(sc)
+	default:
+		return nil, fmt.Errorf("unknown GPU sensor type %q", sc.Type)
+	}
+	if err != nil || len(sc.Indexes) == 0 {
+		return readings, err
+	}
+	return sc.remap(readings), nil
+}
+
+// remap renumbers readings from the backend's GPU indexes to the miner's.
+func (sc *gpuSensorsConf) remap(readings map[int]gpuReadings) map[int]gpuReadings {
+	remapped := make(map[int]gpuReadings, len(readings))
+	moved := make(map[int]bool)
+	for gpu, index := range sc.Indexes {
+		i, _ := strconv.Atoi(gpu)
+		moved[i] = true
+		if r, ok := readings[index]; ok {
+			remapped[i] = r
+		}
+	}
+	for i, r := range readings {
+		if !moved[i] {
+			remapped[i] = r
+		}
+	}
+	return remapped
+}
+
+// gpuSensorMetrics exports the rig's GPU readings, matched to the miner's
+// GPUs by index, the GPUs' efficiencies where there is a power draw, their
+// configured overclocking profiles and the cooling advisories, which use
+// the readings where there are any.
+func gpuSensorMetrics(addr string, conf *expConf, stats *claymore.Stats) []prometheus.Metric {
+	rc := conf.rig(addr)
+	var metrics []prometheus.Metric
+	for i, gpu := range stats.GPUs {
+		profile := rc.OCProfile
+		if p, ok := rc.GPUOCProfiles[strconv.Itoa(i)]; ok {
+			profile = p
+		}
+		if len(profile) != 0 {
+			metrics = append(metrics, prometheus.MustNewConstMetric(gpuOCProfileDesc,
+				prometheus.GaugeValue,
+				1,
+				addr, gpu.Name, profile))
+		}
+	}
+
+	sc := rc.GPUSensors
+	if sc == nil {
+		lastGPUPowers.set(addr, nil)
+		return append(metrics, coolingAdvisoryMetrics(addr, stats, nil)...)
+	}
+	readings, err := readGPUSensors(sc)
+	if err != nil {
+		log.Printf("Reading GPU sensors of %s with %s: %v", addr, sc.Type, err)
+		lastGPUPowers.set(addr, nil)
+		return append(metrics, coolingAdvisoryMetrics(addr, stats, nil)...)
+	}
+	metrics = append(metrics, coolingAdvisoryMetrics(addr, stats, readings)...)
+	watts := make(map[string]float64)
+	for i, gpu := range stats.GPUs {
+		r, ok := readings[i]
+		if !ok || !gpu.Enabled {
+			continue
+		}
+		if r.power != nil {
+			watts[gpu.Name] = *r.power
+		}
+		for _, v := range []struct {
+			desc  *prometheus.Desc
+			value *float64
+			scale float64
+		}{
+			{gpuMemTempDesc, r.mem, 1},
+			{gpuHotspotTempDesc, r.hotspot, 1},
+			{gpuCoreClockDesc, r.coreClock, 1e6},
+			{gpuMemClockDesc, r.memClock, 1e6},
+			{gpuPowerDesc, r.power, 1},
+			{gpuPowerLimitDesc, r.powerLimit, 1},
+		} {
+			if v.value != nil {
+				metrics = append(metrics, prometheus.MustNewConstMetric(v.desc,
+					prometheus.GaugeValue,
+					*v.value*v.scale,
+					addr, gpu.Name))
+			}
+		}
+		// Claymore reports kH/s. Hashrates the sanity checks dropped have
+		// no efficiency.
+		if hashrate, err := strconv.ParseFloat(gpu.HashRate, 64); err == nil && r.power != nil && *r.power > 0 {
+			metrics = append(metrics, prometheus.MustNewConstMetric(gpuEfficiencyDesc,
+				prometheus.GaugeValue,
+				hashrate*1000 / *r.power,
+				addr, gpu.Name))
+		}
+	}
+	lastGPUPowers.set(addr, watts)
+	return metrics
+}
@@ -0,0 +1,190 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// grafanaPanel describes one graph of the generated dashboard. Metric is
+// the name after the claymore_ prefix; Expr wraps its selector, %s, and
+// Legacy, if set, computes the same from the legacy names, %s being their
+// label matchers.
+type grafanaPanel struct {
+	Title  string
+	Metric string
+	Expr   string
+	Legacy string
+	Legend string
+	Unit   string
+}
+
+// dashboardPanels lists the panels in display order.
+var dashboardPanels = []grafanaPanel{
+	{"Total hashrate", "hashrate_hashes_per_second", `%s`, `total_hash_rate%s * 1000`, "{{Rig}}", "Hs"},
+	{"GPU hashrate", "gpu_hashrate_hashes_per_second", `%s`, `gpu_hash_rate%s * 1000`, "{{Rig}} {{GPU}}", "Hs"},
+	{"GPU temperature", "gpu_temperature_celsius", `%s`, `gpu_temp_celsius%s`, "{{Rig}} {{GPU}}", "celsius"},
+	{"GPU fan speed", "gpu_fan_ratio", `%s`, `gpu_fanspeed_percentage%s / 100`, "{{Rig}} {{GPU}}", "percentunit"},
+	{"Shares found", "shares_found_total", `rate(%s[5m]) * 60`, `rate(eth_found%s[5m]) * 60`, "{{Rig}} {{coin}}", "short"},
+	{"Shares rejected", "shares_rejected_total", `rate(%s[5m]) * 60`, `rate(eth_reject%s[5m]) * 60`, "{{Rig}} {{coin}}", "short"},
+	{"GPU rejected shares", "gpu_shares_rejected_total", `rate(%s[5m]) * 60`, "", "{{Rig}} {{GPU}}", "short"},
+	{"Miner uptime", "miner_uptime_seconds", `%s`, `miner_total_uptime%s * 60`, "{{Rig}}", "s"},
+}
+
+// dashboardNames are the metric names and labels the dashboard queries
+// for, as the exporter is configured to emit them.
+type dashboardNames struct {
+	// prefixes replace claymore_ for the configured rigs' miners.
+	prefixes []string
+	// miners are the rigs' miners with the miner label on, nil without.
+	miners []string
+	legacy bool
+}
+
+func newDashboardNames(conf *expConf, legacy bool) dashboardNames {
+	n := dashboardNames{legacy: legacy}
+	prefixes, miners := make(map[string]bool), make(map[string]bool)
+	for _, addr := range conf.Dial_Addr {
+		miner := conf.miner(addr)
+		prefix := metricPrefix
+		if conf.File != nil && len(conf.File.Miners[miner].Prefix) != 0 {
+			prefix = conf.File.Miners[miner].Prefix
+		}
+		prefixes[prefix] = true
+		miners[miner] = true
+	}
+	if len(prefixes) == 0 {
+		prefixes[metricPrefix] = true
+	}
+	for prefix := range prefixes {
+		n.prefixes = append(n.prefixes, prefix)
+	}
+	sort.Strings(n.prefixes)
+	if conf.File != nil && conf.File.MinerLabel {
+		for miner := range miners {
+			n.miners = append(n.miners, miner)
+		}
+		sort.Strings(n.miners)
+	}
+	return n
+}
+
+// matchers are the label matchers of every query, for the dashboard's
+// variables.
+func (n dashboardNames) matchers() string {
+	if n.miners != nil {
+		return `Rig=~"$rig",miner=~"$miner"`
+	}
+	return `Rig=~"$rig"`
+}
+
+// expr returns the panel's query. With several miner prefixes it selects
+// all their names; with legacy names, rigs only exporting those (older
+// exporters, relabelled targets) are filled in from them.
+func (n dashboardNames) expr(p grafanaPanel) string {
+	var sel string
+	if len(n.prefixes) == 1 {
+		sel = fmt.Sprintf("%s%s{%s}", n.prefixes[0], p.Metric, n.matchers())
+	} else {
+		names := make([]string, len(n.prefixes))
+		for i, prefix := range n.prefixes {
+			names[i] = prefix + p.Metric
+		}
+		sel = fmt.Sprintf(`{__name__=~"%s",%s}`, strings.Join(names, "|"), n.matchers())
+	}
+	expr := fmt.Sprintf(p.Expr, sel)
+	if n.legacy && len(p.Legacy) != 0 {
+		on := "Rig"
+		if strings.Contains(p.Legend, "{{GPU}}") {
+			on = "Rig, GPU"
+		}
+		expr = fmt.Sprintf("%s or on(%s) %s", expr, on, fmt.Sprintf(p.Legacy, "{"+n.matchers()+"}"))
+	}
+	return expr
+}
+
+func (n dashboardNames) legend(p grafanaPanel) string {
+	if n.miners != nil {
+		return "{{miner}} " + p.Legend
+	}
+	return p.Legend
+}
+
+// customVariable is a dashboard variable picking any of values.
+func customVariable(name, label string, values []string) map[string]interface{} {
+	options := []map[string]interface{}{}
+	for _, v := range values {
+		options = append(options, map[string]interface{}{
+			"text": v, "value": v, "selected": false,
+		})
+	}
+	return map[string]interface{}{
+		"name":       name,
+		"label":      label,
+		"type":       "custom",
+		"multi":      true,
+		"includeAll": true,
+		"allValue":   ".*",
+		"query":      strings.Join(values, ","),
+		"options":    options,
+		"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+	}
+}
+
+func grafanaDashboard(conf *expConf, legacy bool) map[string]interface{} {
+	names := newDashboardNames(conf, legacy)
+	variables := []map[string]interface{}{customVariable("rig", "Rig", conf.Dial_Addr)}
+	if names.miners != nil {
+		variables = append(variables, customVariable("miner", "Miner", names.miners))
+	}
+
+	panels := []map[string]interface{}{}
+	for i, p := range dashboardPanels {
+		panels = append(panels, map[string]interface{}{
+			"id":         i + 1,
+			"type":       "timeseries",
+			"title":      p.Title,
+			"datasource": "${DS_PROMETHEUS}",
+			"gridPos":    map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8},
+			"fieldConfig": map[string]interface{}{
+				"defaults": map[string]interface{}{"unit": p.Unit},
+			},
+			"targets": []map[string]interface{}{
+				{"refId": "A", "expr": names.expr(p), "legendFormat": names.legend(p)},
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"__inputs": []map[string]interface{}{{
+			"name":     "DS_PROMETHEUS",
+			"label":    "Prometheus",
+			"type":     "datasource",
+			"pluginId": "prometheus",
+		}},
+		"title":         "Claymore miners",
+		"uid":           "claymore-exporter",
+		"schemaVersion": 27,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating":    map[string]interface{}{"list": variables},
+		"panels":        panels,
+	}
+}
+
+// grafanaHandler serves /grafana/dashboard.json for the configured rigs and
+// the names c exports them under.
+func grafanaHandler(c *ClaymoreStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf := currentConf()
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(grafanaDashboard(conf, c.legacyNames)); err != nil {
+			http.Error(w, fmt.Sprintf("encoding dashboard: %v", err), http.StatusInternalServerError)
+		}
+	}
+}
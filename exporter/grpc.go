@@ -0,0 +1,243 @@
+package exporter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// statsServer implements the claymore.v1.Stats service of
+// proto/claymore.proto. The service only uses well-known types, so it is
+// registered with a hand-written ServiceDesc instead of generated code.
+type statsServer struct {
+	collector *ClaymoreStatsCollector
+	history   *history
+}
+
+// toStruct converts a JSON-encodable document into a Struct.
+func toStruct(doc interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *statsServer) rigsDoc() (*structpb.Struct, uint64, error) {
+	latest, version := s.collector.snapshot()
+	doc, err := toStruct(map[string]interface{}{"rigs": latest})
+	return doc, version, err
+}
+
+func (s *statsServer) ListRigs(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	doc, _, err := s.rigsDoc()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return doc, nil
+}
+
+func (s *statsServer) GetHistory(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if s.history == nil {
+		return nil, status.Error(codes.Unavailable, "history is disabled")
+	}
+
+	field := func(name string) string { return req.GetFields()[name].GetStringValue() }
+	rig := field("rig")
+	if !knownRig(currentConf(), rig) {
+		return nil, status.Errorf(codes.NotFound, "unknown rig %q", rig)
+	}
+
+	doc, err := historyDoc(s.history, rig, field("metric"), field("gpu"), field("range"))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	out, err := toStruct(doc)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return out, nil
+}
+
+// WatchRigs checks for new scrapes once a second and sends the rigs
+// document when there were any.
+func (s *statsServer) WatchRigs(_ *emptypb.Empty, stream grpc.ServerStream) error {
+	var sent uint64
+	first := true
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		doc, version, err := s.rigsDoc()
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if first || version != sent {
+			if err := stream.SendMsg(doc); err != nil {
+				return err
+			}
+			sent, first = version, false
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type statsService interface {
+	ListRigs(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	GetHistory(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	WatchRigs(*emptypb.Empty, grpc.ServerStream) error
+}
+
+var statsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "claymore.v1.Stats",
+	HandlerType: (*statsService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRigs",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &emptypb.Empty{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(statsService).ListRigs(ctx, req.(*emptypb.Empty))
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/claymore.v1.Stats/ListRigs"}, handler)
+			},
+		},
+		{
+			MethodName: "GetHistory",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &structpb.Struct{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(statsService).GetHistory(ctx, req.(*structpb.Struct))
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/claymore.v1.Stats/GetHistory"}, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRigs",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := &emptypb.Empty{}
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(statsService).WatchRigs(in, stream)
+			},
+		},
+	},
+	Metadata: "proto/claymore.proto",
+}
+
+// grpcAuthorize applies auth.protect_reads to a call: like a REST read it
+// needs a bearer token in the authorization metadata, a verified client
+// certificate or a trusted proxy's user header with at least the read
+// scope.
+func grpcAuthorize(ctx context.Context) error {
+	conf := currentConf()
+	if auth := conf.auth(); auth == nil || !auth.ProtectReads {
+		return nil
+	}
+	// authenticate reads credentials from an HTTP request; the call's
+	// metadata are its headers.
+	r := &http.Request{Header: make(http.Header)}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, vs := range md {
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	_, scope, ok := authenticate(r, conf)
+	switch {
+	case !ok:
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	case scope != scopeRead && scope != scopeControl:
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return nil
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := grpcAuthorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := grpcAuthorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// serveGRPC runs the Stats service on addr until the listener fails. It
+// serves TLS with the --web.tls-* certificate and client CAs if set, and
+// checks credentials like the REST reads.
+func serveGRPC(addr string, collector *ClaymoreStatsCollector, h *history, o *serveOpts) error {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcUnaryAuth),
+		grpc.StreamInterceptor(grpcStreamAuth),
+	}
+	if len(o.tlsCertFile) != 0 {
+		tc, err := serverTLSConfig(o.tlsClientCAFile)
+		if err != nil {
+			return err
+		}
+		cert, err := tls.LoadX509KeyPair(o.tlsCertFile, o.tlsKeyFile)
+		if err != nil {
+			return err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tc)))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&statsServiceDesc, &statsServer{collector: collector, history: h})
+	return srv.Serve(lis)
+}
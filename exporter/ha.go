@@ -0,0 +1,423 @@
+package exporter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var leaderDesc = prometheus.NewDesc(
+	"claymore_exporter_leader",
+	"1 while this exporter holds the HA lease and polls the miners, 0 while it is on standby",
+	[]string{"identity", "holder"},
+	nil)
+
+// leaseLock is where exporters running against the same farm hold their
+// lease.
+type leaseLock interface {
+	// acquire takes or renews the lease for identity for ttl unless another
+	// identity holds an unexpired one, and returns the holder.
+	acquire(identity string, ttl time.Duration) (holder string, err error)
+	String() string
+}
+
+// newLeaseLock parses --ha.lock: file:<path>, consul:<url of the key> or
+// k8s:<namespace>/<name>.
+func newLeaseLock(spec string) (leaseLock, error) {
+	kind := strings.SplitN(spec, ":", 2)
+	if len(kind) != 2 || len(kind[1]) == 0 {
+		return nil, fmt.Errorf("bad lock %q, want file:<path>, consul:<url> or k8s:<namespace>/<name>", spec)
+	}
+	switch kind[0] {
+	case "file":
+		return &fileLease{path: kind[1]}, nil
+	case "consul":
+		u, err := url.Parse(kind[1])
+		if err != nil || len(u.Host) == 0 || len(strings.Trim(u.Path, "/")) == 0 {
+			return nil, fmt.Errorf("bad consul lock %q, want e.g. consul:http://127.0.0.1:8500/claymore/leader", spec)
+		}
+		return &consulLease{
+			addr:  u.Scheme + "://" + u.Host,
+			key:   strings.Trim(u.Path, "/"),
+			token: os.Getenv("CONSUL_HTTP_TOKEN"),
+		}, nil
+	case "k8s":
+		parts := strings.Split(kind[1], "/")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("bad k8s lock %q, want k8s:<namespace>/<name>", spec)
+		}
+		return newK8sLease(parts[0], parts[1])
+	}
+	return nil, fmt.Errorf("unknown lock type %q", kind[0])
+}
+
+// elector keeps this exporter's lease. Without --ha.lock there is none and
+// the exporter always leads.
+type elector struct {
+	lock     leaseLock
+	identity string
+	ttl      time.Duration
+
+	leader atomic.Value // bool
+	holder atomic.Value // string
+}
+
+var election *elector
+
+// isLeader reports whether this exporter should poll the miners.
+func isLeader() bool {
+	if election == nil {
+		return true
+	}
+	return election.leader.Load().(bool)
+}
+
+func newElector(lock leaseLock, identity string, ttl time.Duration) *elector {
+	e := &elector{lock: lock, identity: identity, ttl: ttl}
+	e.leader.Store(false)
+	e.holder.Store("")
+	return e
+}
+
+// run renews the lease three times per ttl. An exporter that can't reach
+// the lock steps down once its lease has run out, as the standby may have
+// taken over by then.
+func (e *elector) run() {
+	var renewed time.Time
+	for {
+		holder, err := e.lock.acquire(e.identity, e.ttl)
+		leader := e.leader.Load().(bool)
+		switch {
+		case err != nil:
+			log.Printf("Renewing HA lease at %s: %v", e.lock, err)
+			if leader && time.Since(renewed) >= e.ttl {
+				log.Printf("HA lease expired, standing by")
+				e.leader.Store(false)
+			}
+		case holder == e.identity:
+			renewed = time.Now()
+			if !leader {
+				log.Printf("Acquired HA lease at %s, polling the miners", e.lock)
+			}
+			e.leader.Store(true)
+			e.holder.Store(holder)
+		default:
+			if leader {
+				log.Printf("HA lease at %s taken by %s, standing by", e.lock, holder)
+			}
+			e.leader.Store(false)
+			e.holder.Store(holder)
+		}
+		time.Sleep(e.ttl / 3)
+	}
+}
+
+func (e *elector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- leaderDesc
+}
+
+func (e *elector) Collect(ch chan<- prometheus.Metric) {
+	v := 0.0
+	if e.leader.Load().(bool) {
+		v = 1
+	}
+	ch <- prometheus.MustNewConstMetric(leaderDesc,
+		prometheus.GaugeValue,
+		v,
+		e.identity, e.holder.Load().(string))
+}
+
+// leaseRecord is the file lease's content.
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// fileLease is a lease in a file on storage both exporters share, e.g. NFS.
+// Two exporters taking an expired lease at once both write it; the one
+// reading back its own identity wins.
+type fileLease struct {
+	path string
+}
+
+func (f *fileLease) String() string { return "file:" + f.path }
+
+func (f *fileLease) read() (leaseRecord, error) {
+	var rec leaseRecord
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return rec, nil
+	}
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("decoding %s: %v", f.path, err)
+	}
+	return rec, nil
+}
+
+func (f *fileLease) acquire(identity string, ttl time.Duration) (string, error) {
+	rec, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	if rec.Holder != identity && time.Now().Before(rec.Expires) {
+		return rec.Holder, nil
+	}
+
+	data, _ := json.Marshal(leaseRecord{Holder: identity, Expires: time.Now().Add(ttl)})
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".claymore-lease-")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if rec, err = f.read(); err != nil {
+		return "", err
+	}
+	return rec.Holder, nil
+}
+
+// consulLease is a Consul lock: a KV key acquired with a session whose TTL
+// is the lease's. Consul releases the key when the session expires.
+type consulLease struct {
+	addr, key, token string
+	session          string
+}
+
+func (c *consulLease) String() string { return "consul:" + c.addr + "/" + c.key }
+
+func (c *consulLease) do(method, path string, body interface{}, v interface{}) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.addr+"/v1/"+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if len(c.token) != 0 {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp.StatusCode, fmt.Errorf("decoding %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *consulLease) acquire(identity string, ttl time.Duration) (string, error) {
+	if len(c.session) != 0 {
+		status, err := c.do(http.MethodPut, "session/renew/"+c.session, nil, nil)
+		if status == http.StatusNotFound {
+			c.session = ""
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if len(c.session) == 0 {
+		var created struct{ ID string }
+		if _, err := c.do(http.MethodPut, "session/create", map[string]string{
+			"Name":      "claymore_exporter " + identity,
+			"TTL":       ttl.String(),
+			"Behavior":  "release",
+			"LockDelay": "0s",
+		}, &created); err != nil {
+			return "", err
+		}
+		c.session = created.ID
+	}
+
+	var acquired bool
+	if _, err := c.do(http.MethodPut, "kv/"+c.key+"?acquire="+c.session, identity, &acquired); err != nil {
+		return "", err
+	}
+	if acquired {
+		return identity, nil
+	}
+	var kv []struct {
+		Value []byte
+	}
+	if _, err := c.do(http.MethodGet, "kv/"+c.key, nil, &kv); err != nil {
+		return "", err
+	}
+	if len(kv) == 0 {
+		return "", nil
+	}
+	var holder string
+	json.Unmarshal(kv[0].Value, &holder)
+	return holder, nil
+}
+
+const k8sServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// k8sLease is a coordination.k8s.io Lease, updated with the exporter pod's
+// service account. The resourceVersion makes concurrent takeovers fail for
+// all but one.
+type k8sLease struct {
+	namespace, name string
+	api             string
+	token           string
+	client          *http.Client
+}
+
+func newK8sLease(namespace, name string) (*k8sLease, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 {
+		return nil, fmt.Errorf("k8s lock needs to run in a pod, KUBERNETES_SERVICE_HOST is not set")
+	}
+	ca, err := os.ReadFile(filepath.Join(k8sServiceAccount, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in the service account's ca.crt")
+	}
+	if len(port) == 0 {
+		port = "443"
+	}
+	return &k8sLease{
+		namespace: namespace,
+		name:      name,
+		api:       "https://" + strings.Trim(host, "[]") + ":" + port,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+func (k *k8sLease) String() string { return "k8s:" + k.namespace + "/" + k.name }
+
+type k8sLeaseObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// k8sMicroTime is the format of the Lease's MicroTime fields.
+const k8sMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+func (k *k8sLease) do(method, path string, body, v interface{}) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, k.api+"/apis/coordination.k8s.io/v1/namespaces/"+k.namespace+"/leases"+path, r)
+	if err != nil {
+		return 0, err
+	}
+	// The kubelet rotates the token, it is read on every request.
+	token, err := os.ReadFile(filepath.Join(k8sServiceAccount, "token"))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s lease %s: %s %s", method, k.name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp.StatusCode, fmt.Errorf("decoding lease %s: %v", k.name, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (k *k8sLease) acquire(identity string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	var lease k8sLeaseObject
+	status, err := k.do(http.MethodGet, "/"+k.name, nil, &lease)
+	if status == http.StatusNotFound {
+		lease.APIVersion, lease.Kind = "coordination.k8s.io/v1", "Lease"
+		lease.Metadata.Name, lease.Metadata.Namespace = k.name, k.namespace
+	} else if err != nil {
+		return "", err
+	}
+
+	spec := &lease.Spec
+	if spec.HolderIdentity != identity && len(spec.HolderIdentity) != 0 {
+		renewed, err := time.Parse(k8sMicroTime, spec.RenewTime)
+		if err == nil && now.Before(renewed.Add(time.Duration(spec.LeaseDurationSeconds)*time.Second)) {
+			return spec.HolderIdentity, nil
+		}
+	}
+	if spec.HolderIdentity != identity {
+		if len(spec.HolderIdentity) != 0 {
+			spec.LeaseTransitions++
+		}
+		spec.HolderIdentity = identity
+		spec.AcquireTime = now.UTC().Format(k8sMicroTime)
+	}
+	spec.LeaseDurationSeconds = int((ttl + time.Second - 1) / time.Second)
+	spec.RenewTime = now.UTC().Format(k8sMicroTime)
+
+	if status == http.StatusNotFound {
+		status, err = k.do(http.MethodPost, "", &lease, nil)
+	} else {
+		status, err = k.do(http.MethodPut, "/"+k.name, &lease, nil)
+	}
+	if status == http.StatusConflict {
+		// Another exporter got there first, the next round reads its lease.
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return identity, nil
+}
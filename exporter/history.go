@@ -0,0 +1,257 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+)
+
+// historySample is one rig reading, numbers already parsed.
+type historySample struct {
+	Time      time.Time          `json:"time"`
+	Uptime    float64            `json:"uptime"`
+	TotalRate float64            `json:"hashrate"`
+	EthFound  float64            `json:"shares"`
+	EthReject float64            `json:"rejected"`
+	GPUs      []historyGPUSample `json:"gpus"`
+	Pool      string             `json:"pool,omitempty"`
+	// Down marks the zero sample of a rig that didn't answer or whose reply
+	// couldn't be parsed.
+	Down bool `json:"down,omitempty"`
+}
+
+type historyGPUSample struct {
+	Name     string  `json:"gpu"`
+	HashRate float64 `json:"hashrate"`
+	Temp     float64 `json:"temp"`
+	FanSpeed float64 `json:"fanspeed"`
+	// Power is the draw the rig's GPU sensor backend last reported, in W.
+	Power float64 `json:"power,omitempty"`
+}
+
+func newHistorySample(t time.Time, stats *claymore.Stats) historySample {
+	s := historySample{Time: t}
+	s.Uptime, _ = strconv.ParseFloat(stats.Uptime, 64)
+	s.TotalRate, _ = strconv.ParseFloat(stats.TotalRate, 64)
+	s.EthFound, _ = strconv.ParseFloat(stats.EthFound, 64)
+	s.EthReject, _ = strconv.ParseFloat(stats.EthReject, 64)
+	s.Pool = stats.Pool
+
+	for _, gpu := range stats.GPUs {
+		if !gpu.Enabled {
+			continue
+		}
+		g := historyGPUSample{Name: gpu.Name}
+		g.HashRate, _ = strconv.ParseFloat(gpu.HashRate, 64)
+		g.Temp, _ = strconv.ParseFloat(gpu.Temp, 64)
+		g.FanSpeed, _ = strconv.ParseFloat(gpu.FanSpeed, 64)
+		s.GPUs = append(s.GPUs, g)
+	}
+	return s
+}
+
+// value returns the named metric of the sample. GPU metrics need the gpu
+// label; ok is false if the sample has no such value.
+func (s historySample) value(metric, gpu string) (v float64, ok bool) {
+	switch metric {
+	case "uptime":
+		return s.Uptime, true
+	case "hashrate":
+		return s.TotalRate, true
+	case "shares":
+		return s.EthFound, true
+	case "rejected":
+		return s.EthReject, true
+	}
+
+	for _, g := range s.GPUs {
+		if g.Name != gpu {
+			continue
+		}
+		switch metric {
+		case "gpu_hashrate":
+			return g.HashRate, true
+		case "gpu_temp":
+			return g.Temp, true
+		case "gpu_fanspeed":
+			return g.FanSpeed, true
+		}
+	}
+	return 0, false
+}
+
+// ring keeps the newest samples of one rig, at most one per resolution step.
+type ring struct {
+	samples []historySample
+	next    int
+	full    bool
+}
+
+func (r *ring) last() *historySample {
+	if r.next == 0 && !r.full {
+		return nil
+	}
+	i := (r.next - 1 + len(r.samples)) % len(r.samples)
+	return &r.samples[i]
+}
+
+func (r *ring) add(s historySample) {
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns the samples newer than t, oldest first.
+func (r *ring) since(t time.Time) []historySample {
+	var out []historySample
+	n := r.next
+	if r.full {
+		n = len(r.samples)
+	}
+	for i := 0; i < n; i++ {
+		s := r.samples[(r.next-n+i+len(r.samples))%len(r.samples)]
+		if s.Time.After(t) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// history is an in-memory window of per-rig samples.
+type history struct {
+	mu         sync.Mutex
+	size       int
+	resolution time.Duration
+	rigs       map[string]*ring
+	incidents  *outageLog
+
+	// store, if set, persists samples and answers queries instead of
+	// the in-memory rings.
+	store *sqliteStore
+}
+
+// newHistory keeps window worth of samples at the given resolution, and
+// the rigs' incidents for incidentRetention. It returns nil, which records
+// nothing, if window is zero.
+func newHistory(window, resolution, incidentRetention time.Duration) *history {
+	if window <= 0 || resolution <= 0 {
+		return nil
+	}
+	// A ring needs room for at least the newest sample.
+	size := int(window / resolution)
+	if size < 1 {
+		size = 1
+	}
+	return &history{
+		size:       size,
+		resolution: resolution,
+		rigs:       make(map[string]*ring),
+		incidents:  newOutageLog(incidentRetention),
+	}
+}
+
+func (h *history) record(rig string, s historySample) {
+	if h == nil {
+		return
+	}
+	if h.store != nil {
+		h.store.record(rig, s)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i := h.incidents.record(rig, s); i != nil && h.store != nil {
+		h.store.recordIncident(*i)
+	}
+
+	r, ok := h.rigs[rig]
+	if !ok {
+		r = &ring{samples: make([]historySample, h.size)}
+		h.rigs[rig] = r
+	}
+
+	// Replace the newest sample while still inside its resolution step,
+	// so frequent scrapes don't shorten the window.
+	if last := r.last(); last != nil && s.Time.Sub(last.Time) < h.resolution {
+		*last = s
+		return
+	}
+	r.add(s)
+}
+
+func (h *history) query(rig string, since time.Time) []historySample {
+	if h == nil {
+		return nil
+	}
+	if h.store != nil {
+		return h.store.query(rig, since)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rigs[rig]
+	if !ok {
+		return nil
+	}
+	return r.since(since)
+}
+
+type historyPoint struct {
+	Time  int64   `json:"t"`
+	Value float64 `json:"v"`
+}
+
+// historyDoc is the document returned by the history API.
+func historyDoc(h *history, rig, metric, gpu, rangeStr string) (map[string]interface{}, error) {
+	if len(metric) == 0 {
+		metric = "hashrate"
+	}
+
+	rng := time.Hour
+	if len(rangeStr) != 0 {
+		d, err := time.ParseDuration(rangeStr)
+		if err != nil {
+			return nil, fmt.Errorf("bad range: %v", err)
+		}
+		rng = d
+	}
+
+	points := []historyPoint{}
+	for _, s := range h.query(rig, time.Now().Add(-rng)) {
+		if v, ok := s.value(metric, gpu); ok {
+			points = append(points, historyPoint{Time: s.Time.Unix(), Value: v})
+		}
+	}
+
+	return map[string]interface{}{
+		"rig":    rig,
+		"metric": metric,
+		"gpu":    gpu,
+		"points": points,
+	}, nil
+}
+
+// historyHandler serves /api/v1/rigs/{rig}/history?metric=hashrate&range=6h.
+func historyHandler(w http.ResponseWriter, r *http.Request, h *history, rig string) {
+	if h == nil {
+		http.Error(w, "history is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	doc, err := historyDoc(h, rig, q.Get("metric"), q.Get("gpu"), q.Get("range"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,171 @@
+package exporter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS samples (
+	rig    TEXT    NOT NULL,
+	bucket INTEGER NOT NULL,
+	time   INTEGER NOT NULL,
+	data   TEXT    NOT NULL,
+	PRIMARY KEY (rig, bucket)
+);
+CREATE INDEX IF NOT EXISTS samples_time ON samples (time);
+CREATE TABLE IF NOT EXISTS incidents (
+	rig     TEXT    NOT NULL,
+	started INTEGER NOT NULL,
+	ended   INTEGER,
+	PRIMARY KEY (rig, started)
+);
+`
+
+// sqliteStore persists history samples so they survive restarts. Samples
+// are keyed by resolution step, a newer reading in the same step replaces
+// the older one just like in the in-memory ring.
+type sqliteStore struct {
+	db                *sql.DB
+	resolution        time.Duration
+	retention         time.Duration
+	incidentRetention time.Duration
+}
+
+func openSQLiteStore(path string, resolution, retention, incidentRetention time.Duration) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer at a time.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &sqliteStore{db: db, resolution: resolution, retention: retention, incidentRetention: incidentRetention}
+	go s.prune()
+	return s, nil
+}
+
+func (s *sqliteStore) record(rig string, sample historySample) {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		log.Print("History store:", err)
+		return
+	}
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO samples (rig, bucket, time, data) VALUES (?, ?, ?, ?)`,
+		rig, sample.Time.UnixNano()/int64(s.resolution), sample.Time.Unix(), string(data))
+	if err != nil {
+		log.Print("History store:", err)
+	}
+}
+
+func (s *sqliteStore) query(rig string, since time.Time) []historySample {
+	rows, err := s.db.Query(`SELECT data FROM samples WHERE rig = ? AND time > ? ORDER BY time`,
+		rig, since.Unix())
+	if err != nil {
+		log.Print("History store:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var out []historySample
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			log.Print("History store:", err)
+			return out
+		}
+		var sample historySample
+		if err := json.Unmarshal([]byte(data), &sample); err != nil {
+			log.Print("History store:", err)
+			continue
+		}
+		out = append(out, sample)
+	}
+	return out
+}
+
+// recordIncident stores an outage, replacing the open one it ends.
+func (s *sqliteStore) recordIncident(i outage) {
+	var end interface{}
+	if !i.End.IsZero() {
+		end = i.End.UnixNano()
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO incidents (rig, started, ended) VALUES (?, ?, ?)`,
+		i.Rig, i.Start.UnixNano(), end)
+	if err != nil {
+		log.Print("History store:", err)
+	}
+}
+
+// queryIncidents returns the rig's incidents, all rigs' if rig is empty,
+// that overlap the time since.
+func (s *sqliteStore) queryIncidents(rig string, since time.Time) []outage {
+	rows, err := s.db.Query(`SELECT rig, started, ended FROM incidents WHERE (? = '' OR rig = ?) AND (ended IS NULL OR ended > ?)`,
+		rig, rig, since.UnixNano())
+	if err != nil {
+		log.Print("History store:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var out []outage
+	for rows.Next() {
+		var i outage
+		var start int64
+		var end sql.NullInt64
+		if err := rows.Scan(&i.Rig, &start, &end); err != nil {
+			log.Print("History store:", err)
+			return out
+		}
+		i.Start = time.Unix(0, start)
+		if end.Valid {
+			i.End = time.Unix(0, end.Int64)
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// openIncidents returns the incidents still open when the exporter last
+// stopped, for the history to carry on.
+func (s *sqliteStore) openIncidents() []outage {
+	var out []outage
+	for _, i := range s.queryIncidents("", time.Now()) {
+		if i.End.IsZero() {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// prune deletes samples and ended incidents older than their retention
+// once per resolution step.
+func (s *sqliteStore) prune() {
+	if s.retention <= 0 && s.incidentRetention <= 0 {
+		return
+	}
+	for now := range time.Tick(s.resolution) {
+		if s.retention > 0 {
+			cutoff := now.Add(-s.retention).Unix()
+			if _, err := s.db.Exec(`DELETE FROM samples WHERE time < ?`, cutoff); err != nil {
+				log.Print("History store:", err)
+			}
+		}
+		if s.incidentRetention > 0 {
+			cutoff := now.Add(-s.incidentRetention).UnixNano()
+			if _, err := s.db.Exec(`DELETE FROM incidents WHERE ended < ?`, cutoff); err != nil {
+				log.Print("History store:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rigDowntimeDesc = prometheus.NewDesc(
+	"claymore_rig_downtime_seconds_total",
+	"Time the rig was down since the exporter started, from its history samples",
+	[]string{"Rig"},
+	nil)
+
+// outage is a period a rig was down, from the first sample it didn't
+// answer to the first it answered again. End is zero while it's still down.
+type outage struct {
+	Rig        string
+	Start, End time.Time
+}
+
+// downtime returns how much of the outage falls between from and to.
+func (i outage) downtime(from, to time.Time) time.Duration {
+	start, end := i.Start, i.End
+	if end.IsZero() || end.After(to) {
+		end = to
+	}
+	if start.Before(from) {
+		start = from
+	}
+	if end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// outageLog keeps the rigs' up/down transitions as outages, ended ones
+// for the retention, and the downtime since started for the counter.
+type outageLog struct {
+	started   time.Time
+	retention time.Duration
+	open      map[string]*outage
+	ended     []outage
+	downtime  map[string]time.Duration
+}
+
+func newOutageLog(retention time.Duration) *outageLog {
+	return &outageLog{
+		started:   time.Now(),
+		retention: retention,
+		open:      make(map[string]*outage),
+		downtime:  make(map[string]time.Duration),
+	}
+}
+
+// record follows the rig's samples, opening an outage on the first down
+// one and ending it on the next up one. It returns the outage that
+// changed, if any. The caller holds the history's lock.
+func (l *outageLog) record(rig string, s historySample) *outage {
+	i, down := l.open[rig]
+	switch {
+	case s.Down && !down:
+		i = &outage{Rig: rig, Start: s.Time}
+		l.open[rig] = i
+		return i
+	case !s.Down && down:
+		delete(l.open, rig)
+		i.End = s.Time
+		// An outage carried over from before a restart only counts from
+		// the start.
+		l.downtime[rig] += i.downtime(l.started, i.End)
+		l.ended = append(l.ended, *i)
+		l.prune(s.Time)
+		return i
+	}
+	return nil
+}
+
+func (l *outageLog) prune(now time.Time) {
+	if l.retention <= 0 {
+		return
+	}
+	n := 0
+	for _, i := range l.ended {
+		if now.Sub(i.End) <= l.retention {
+			l.ended[n] = i
+			n++
+		}
+	}
+	l.ended = l.ended[:n]
+}
+
+// query returns the rig's incidents, all rigs' if rig is empty, that
+// overlap the time since, oldest first.
+func (l *outageLog) query(rig string, since time.Time) []outage {
+	var out []outage
+	for _, i := range l.ended {
+		if (len(rig) == 0 || i.Rig == rig) && i.End.After(since) {
+			out = append(out, i)
+		}
+	}
+	for _, i := range l.open {
+		if len(rig) == 0 || i.Rig == rig {
+			out = append(out, *i)
+		}
+	}
+	return out
+}
+
+// queryIncidents returns the outages overlapping the time since, from the
+// database if history is stored in one.
+func (h *history) queryIncidents(rig string, since time.Time) []outage {
+	if h == nil {
+		return nil
+	}
+	var out []outage
+	if h.store != nil {
+		out = h.store.queryIncidents(rig, since)
+	} else {
+		h.mu.Lock()
+		out = h.incidents.query(rig, since)
+		h.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+func (h *history) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rigDowntimeDesc
+}
+
+// Collect exports the downtime counters, the incidents still open counting
+// up to now.
+func (h *history) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	downtime := make(map[string]time.Duration)
+	for rig, d := range h.incidents.downtime {
+		downtime[rig] = d
+	}
+	for rig, i := range h.incidents.open {
+		downtime[rig] += i.downtime(h.incidents.started, now)
+	}
+	for rig, d := range downtime {
+		ch <- prometheus.MustNewConstMetric(rigDowntimeDesc,
+			prometheus.CounterValue,
+			d.Seconds(),
+			rig)
+	}
+}
+
+// incidentsHandler serves /api/v1/incidents?rig=192.168.1.1&range=168h,
+// all rigs and the last 24h by default, with each rig's downtime in the
+// range.
+func incidentsHandler(h *history) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h == nil {
+			http.Error(w, "history is disabled", http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		rng := 24 * time.Hour
+		if s := q.Get("range"); len(s) != 0 {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("bad range %q", s), http.StatusBadRequest)
+				return
+			}
+			rng = d
+		}
+		now := time.Now()
+		since := now.Add(-rng)
+		type incidentDoc struct {
+			Rig   string    `json:"rig"`
+			Start time.Time `json:"start"`
+			// End is missing while the rig is still down.
+			End      *time.Time `json:"end,omitempty"`
+			Duration float64    `json:"duration_seconds"`
+		}
+		incidents := []incidentDoc{}
+		downtime := make(map[string]float64)
+		for _, i := range h.queryIncidents(q.Get("rig"), since) {
+			doc := incidentDoc{Rig: i.Rig, Start: i.Start, Duration: i.downtime(i.Start, now).Seconds()}
+			if !i.End.IsZero() {
+				end := i.End
+				doc.End = &end
+			}
+			incidents = append(incidents, doc)
+			downtime[i.Rig] += i.downtime(since, now).Seconds()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"since":            since,
+			"incidents":        incidents,
+			"downtime_seconds": downtime,
+		})
+	}
+}
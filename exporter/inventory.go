@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+)
+
+// rigInventory is what the exporter knows about a rig's hardware and
+// software, from its replies and the config file.
+type rigInventory struct {
+	Rig       string            `json:"rig"`
+	Miner     string            `json:"miner,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Pool      string            `json:"pool,omitempty"`
+	GPUCount  int               `json:"gpu_count"`
+	GPUs      []string          `json:"gpus,omitempty"`
+	GPUModels map[string]string `json:"gpu_models,omitempty"`
+	FirstSeen *time.Time        `json:"first_seen,omitempty"`
+	LastSeen  *time.Time        `json:"last_seen,omitempty"`
+}
+
+// phoenixVersion matches PhoenixMiner versions, which end in a letter.
+var phoenixVersion = regexp.MustCompile(`^\d+\.\d+[a-z] `)
+
+// minerType guesses the miner from its version string. Claymore's API is
+// spoken by several miners that only differ in how they report versions.
+func minerType(version string) string {
+	switch {
+	case strings.HasPrefix(version, "ethminer"):
+		return "ethminer"
+	case strings.HasSuffix(version, "- TRM"):
+		return "teamredminer"
+	case phoenixVersion.MatchString(version):
+		return "phoenixminer"
+	}
+	return "claymore"
+}
+
+// updateInventory records a rig's successful reply.
+func (c *ClaymoreStatsCollector) updateInventory(addr string, stats *claymore.Stats, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inv, ok := c.inventory[addr]
+	if !ok {
+		first := now
+		inv = &rigInventory{Rig: addr, FirstSeen: &first}
+		c.inventory[addr] = inv
+	}
+	last := now
+	inv.LastSeen = &last
+	inv.Miner = minerType(stats.Version)
+	inv.Version = stats.Version
+	inv.Pool = stats.Pool
+	inv.GPUCount = len(stats.GPUs)
+	inv.GPUs = nil
+	for _, gpu := range stats.GPUs {
+		inv.GPUs = append(inv.GPUs, gpu.Name)
+	}
+}
+
+// inventoryDoc returns the inventory of every configured rig; rigs that
+// never answered only have their name.
+func (c *ClaymoreStatsCollector) inventoryDoc(conf *expConf) []rigInventory {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := []rigInventory{}
+	for _, addr := range conf.Dial_Addr {
+		inv := rigInventory{Rig: addr}
+		if known, ok := c.inventory[addr]; ok {
+			inv = *known
+		}
+		for index, model := range conf.rig(addr).GPUModels {
+			if i, err := strconv.Atoi(index); err == nil {
+				if inv.GPUModels == nil {
+					inv.GPUModels = make(map[string]string)
+				}
+				inv.GPUModels[conf.gpuName(addr, i, "")] = model
+			}
+		}
+		out = append(out, inv)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rig < out[j].Rig })
+	return out
+}
+
+// inventoryHandler serves /api/v1/inventory.
+func inventoryHandler(c *ClaymoreStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"rigs": c.inventoryDoc(currentConf())})
+	}
+}
@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+)
+
+// journaldSocket is where systemd-journald takes messages in its native
+// protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journald writes to the systemd journal with a priority for every level.
+type journald struct {
+	conn net.Conn
+}
+
+func openJournald() (*journald, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &journald{conn: conn}, nil
+}
+
+// journaldPriority maps a level to a syslog priority: err, warning, info
+// or debug.
+func journaldPriority(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "3"
+	case level >= slog.LevelWarn:
+		return "4"
+	case level >= slog.LevelInfo:
+		return "6"
+	}
+	return "7"
+}
+
+func (j *journald) writeLevel(level slog.Level, msg []byte) error {
+	var b bytes.Buffer
+	b.WriteString("PRIORITY=" + journaldPriority(level) + "\n")
+	b.WriteString("SYSLOG_IDENTIFIER=claymore_exporter\n")
+	if bytes.IndexByte(msg, '\n') < 0 {
+		b.WriteString("MESSAGE=")
+		b.Write(msg)
+		b.WriteByte('\n')
+	} else {
+		// Multi-line values are sent with their length instead.
+		b.WriteString("MESSAGE\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(msg)))
+		b.Write(msg)
+		b.WriteByte('\n')
+	}
+	_, err := j.conn.Write(b.Bytes())
+	return err
+}
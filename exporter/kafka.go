@@ -0,0 +1,309 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// kafkaPublisher produces to a Kafka topic with the plain wire protocol:
+// Metadata v4 to find the partition leaders and Produce v3 with one record
+// batch per message, acks from the leader only. No TLS, SASL or
+// compression; messages with the same key (the rig) go to the same
+// partition.
+type kafkaPublisher struct {
+	brokers []string
+	topic   string
+
+	mu sync.Mutex
+	// partitions is the topic's partition count and leaders maps those
+	// with a leader to its address, from the last metadata request at
+	// refreshed.
+	partitions int32
+	leaders    map[int32]string
+	refreshed  time.Time
+	conns      map[string]net.Conn
+	corrID     int32
+}
+
+const (
+	kafkaProduce  = 0
+	kafkaMetadata = 3
+)
+
+// kafkaLeaderRetry is how often metadata is asked again for a partition
+// without a leader, e.g. while the cluster elects one.
+const kafkaLeaderRetry = 5 * time.Second
+
+func newKafkaPublisher(brokers []string, topic string) *kafkaPublisher {
+	return &kafkaPublisher{brokers: brokers, topic: topic, conns: make(map[string]net.Conn)}
+}
+
+func (k *kafkaPublisher) String() string { return "Kafka" }
+
+// kafkaWriter builds requests in Kafka's big endian encoding.
+type kafkaWriter struct{ bytes.Buffer }
+
+func (w *kafkaWriter) int8(v int8)   { w.WriteByte(byte(v)) }
+func (w *kafkaWriter) int16(v int16) { binary.Write(w, binary.BigEndian, v) }
+func (w *kafkaWriter) int32(v int32) { binary.Write(w, binary.BigEndian, v) }
+func (w *kafkaWriter) int64(v int64) { binary.Write(w, binary.BigEndian, v) }
+func (w *kafkaWriter) str(s string)  { w.int16(int16(len(s))); w.WriteString(s) }
+
+// varint writes a zigzag varint, as records use.
+func (w *kafkaWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+// kafkaReader decodes responses, remembering the first error.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errors.New("short response")
+		return make([]byte, n)
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *kafkaReader) int8() int8   { return int8(r.next(1)[0]) }
+func (r *kafkaReader) int16() int16 { return int16(binary.BigEndian.Uint16(r.next(2))) }
+func (r *kafkaReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.next(4))) }
+func (r *kafkaReader) int64() int64 { return int64(binary.BigEndian.Uint64(r.next(8))) }
+
+func (r *kafkaReader) str() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// kafkaRecordBatch encodes msg as a record batch (magic 2) of one record.
+func kafkaRecordBatch(key string, msg []byte, now time.Time) []byte {
+	var rec kafkaWriter
+	rec.int8(0)   // attributes
+	rec.varint(0) // timestamp delta
+	rec.varint(0) // offset delta
+	rec.varint(int64(len(key)))
+	rec.WriteString(key)
+	rec.varint(int64(len(msg)))
+	rec.Write(msg)
+	rec.varint(0) // headers
+
+	// The CRC covers everything from the attributes on.
+	var body kafkaWriter
+	ts := now.UnixNano() / int64(time.Millisecond)
+	body.int16(0) // attributes: no compression, create time
+	body.int32(0) // last offset delta
+	body.int64(ts)
+	body.int64(ts)
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(1)  // records
+	body.varint(int64(rec.Len()))
+	body.Write(rec.Bytes())
+
+	var batch kafkaWriter
+	batch.int64(0) // base offset
+	batch.int32(int32(4 + 1 + 4 + body.Len()))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(body.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	batch.Write(body.Bytes())
+	return batch.Bytes()
+}
+
+// roundTrip sends a request to the broker at addr and returns the
+// response after the correlation id. k.mu must be held.
+func (k *kafkaPublisher) roundTrip(addr string, apiKey, version int16, body []byte) (*kafkaReader, error) {
+	conn, ok := k.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = net.DialTimeout("tcp", addr, 5*time.Second); err != nil {
+			return nil, err
+		}
+		k.conns[addr] = conn
+	}
+	fail := func(err error) (*kafkaReader, error) {
+		conn.Close()
+		delete(k.conns, addr)
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	k.corrID++
+	var req kafkaWriter
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(k.corrID)
+	req.str("claymore_exporter")
+	req.Write(body)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(req.Len()))
+	if _, err := conn.Write(append(size[:], req.Bytes()...)); err != nil {
+		return fail(err)
+	}
+
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return fail(err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 16<<20 {
+		return fail(fmt.Errorf("bad response size %d", n))
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return fail(err)
+	}
+	r := &kafkaReader{b: resp}
+	if id := r.int32(); id != k.corrID {
+		return fail(fmt.Errorf("response to request %d, want %d", id, k.corrID))
+	}
+	return r, nil
+}
+
+// refreshLeaders asks the brokers in turn for the topic's partitions and
+// their leaders. k.mu must be held.
+func (k *kafkaPublisher) refreshLeaders() error {
+	var req kafkaWriter
+	req.int32(1)
+	req.str(k.topic)
+	req.int8(0) // don't create the topic
+
+	var err error
+	for _, broker := range k.brokers {
+		addr := net.JoinHostPort(splitTarget(broker, "9092"))
+		var r *kafkaReader
+		if r, err = k.roundTrip(addr, kafkaMetadata, 4, req.Bytes()); err != nil {
+			continue
+		}
+		r.int32() // throttle time
+		nodes := make(map[int32]string)
+		for i := r.int32(); i > 0 && r.err == nil; i-- {
+			id := r.int32()
+			host := r.str()
+			port := r.int32()
+			r.str() // rack
+			nodes[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		r.str()   // cluster id
+		r.int32() // controller id
+		leaders := make(map[int32]string)
+		var partitions int32
+		for i := r.int32(); i > 0 && r.err == nil; i-- {
+			topicErr := r.int16()
+			r.str()  // name
+			r.int8() // internal
+			if topicErr != 0 {
+				err = fmt.Errorf("topic %s: error code %d", k.topic, topicErr)
+			}
+			for j := r.int32(); j > 0 && r.err == nil; j-- {
+				partitions++
+				r.int16() // partition error
+				partition := r.int32()
+				leader := r.int32()
+				for n := r.int32(); n > 0 && r.err == nil; n-- {
+					r.int32() // replicas
+				}
+				for n := r.int32(); n > 0 && r.err == nil; n-- {
+					r.int32() // in-sync replicas
+				}
+				if addr, ok := nodes[leader]; ok {
+					leaders[partition] = addr
+				}
+			}
+		}
+		if r.err != nil {
+			err = fmt.Errorf("decoding metadata: %v", r.err)
+			continue
+		}
+		if len(leaders) == 0 {
+			if err == nil {
+				err = fmt.Errorf("topic %s has no partitions with a leader", k.topic)
+			}
+			continue
+		}
+		k.partitions, k.leaders, k.refreshed = partitions, leaders, time.Now()
+		return nil
+	}
+	return err
+}
+
+// partition returns the key's partition, hashing over all the topic's
+// partitions whether or not they have a leader, so a key keeps its
+// partition while another one has none.
+func (k *kafkaPublisher) partition(key string) int32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int32(h.Sum32() % uint32(k.partitions))
+}
+
+func (k *kafkaPublisher) publish(key string, msg []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if len(k.leaders) == 0 {
+		if err := k.refreshLeaders(); err != nil {
+			return err
+		}
+	}
+	partition := k.partition(key)
+	leader, ok := k.leaders[partition]
+	if !ok && time.Since(k.refreshed) >= kafkaLeaderRetry {
+		if err := k.refreshLeaders(); err != nil {
+			return err
+		}
+		partition = k.partition(key)
+		leader, ok = k.leaders[partition]
+	}
+	if !ok {
+		return fmt.Errorf("partition %d has no leader", partition)
+	}
+
+	batch := kafkaRecordBatch(key, msg, time.Now())
+	var req kafkaWriter
+	req.int16(-1) // no transactional id
+	req.int16(1)  // acks from the leader
+	req.int32(10000)
+	req.int32(1)
+	req.str(k.topic)
+	req.int32(1)
+	req.int32(partition)
+	req.int32(int32(len(batch)))
+	req.Write(batch)
+
+	r, err := k.roundTrip(leader, kafkaProduce, 3, req.Bytes())
+	if err != nil {
+		k.leaders = nil
+		return err
+	}
+	r.int32() // topics
+	r.str()
+	r.int32() // partitions
+	r.int32()
+	if code := r.int16(); code != 0 || r.err != nil {
+		// Leadership may have moved, ask again next time.
+		k.leaders = nil
+		if r.err != nil {
+			return fmt.Errorf("decoding produce response: %v", r.err)
+		}
+		return fmt.Errorf("produce to partition %d: error code %d", partition, code)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKafkaRecordBatch(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		msg  string
+		now  time.Time
+		want string
+	}{
+		{
+			name: "small record",
+			key:  "rig1",
+			msg:  `{"type":"alert"}`,
+			now:  time.Unix(1700000000, 0),
+			want: "0000000000000000" + "0000004c" + "ffffffff" + "02" + "65db38eb" +
+				"0000" + "00000000" + "0000018bcfe56800" + "0000018bcfe56800" +
+				"ffffffffffffffff" + "ffff" + "ffffffff" + "00000001" +
+				"34" + "00" + "00" + "00" + "08" + "72696731" + "20" + "7b2274797065223a22616c657274227d" + "00",
+		},
+		{
+			// The record's length takes a two byte varint.
+			name: "long record",
+			key:  "10.0.0.7:3333",
+			msg:  strings.Repeat("x", 100),
+			now:  time.Unix(1234567890, 123000000),
+			want: "0000000000000000" + "000000ab" + "ffffffff" + "02" + "b35e1b4f" +
+				"0000" + "00000000" + "0000011f71fb04cb" + "0000011f71fb04cb" +
+				"ffffffffffffffff" + "ffff" + "ffffffff" + "00000001" +
+				"f001" + "00" + "00" + "00" + "1a" + "31302e302e302e373a33333333" + "c801" + strings.Repeat("78", 100) + "00",
+		},
+	}
+	for _, tt := range tests {
+		batch := kafkaRecordBatch(tt.key, []byte(tt.msg), tt.now)
+		if got := hex.EncodeToString(batch); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+			continue
+		}
+		// The length counts from the partition leader epoch on, the CRC32C
+		// covers everything after itself.
+		if n := binary.BigEndian.Uint32(batch[8:12]); int(n) != len(batch)-12 {
+			t.Errorf("%s: batch length %d, want %d", tt.name, n, len(batch)-12)
+		}
+		crc := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli))
+		if got := binary.BigEndian.Uint32(batch[17:21]); got != crc {
+			t.Errorf("%s: CRC %08x, want %08x", tt.name, got, crc)
+		}
+	}
+}
+
+func TestKafkaPartition(t *testing.T) {
+	k := newKafkaPublisher(nil, "claymore")
+	k.partitions = 3
+	k.leaders = map[int32]string{0: "broker0:9092", 2: "broker2:9092"}
+	seen := make(map[int32]bool)
+	for i := 0; i < 50; i++ {
+		p := k.partition(fmt.Sprintf("192.168.1.%d:3333", i))
+		if p < 0 || p >= 3 {
+			t.Fatalf("partition %d out of the topic's 3", p)
+		}
+		seen[p] = true
+	}
+	// Keys still land on the leaderless partition rather than being
+	// rehashed over the ones with a leader.
+	if !seen[1] {
+		t.Fatalf("no key hashed to partition 1: %v", seen)
+	}
+
+	// Only the key's own partition failing fails its publish, and the
+	// other partitions' leaders are kept.
+	k.refreshed = time.Now()
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("192.168.1.%d:3333", i)
+		if k.partition(key) != 1 {
+			continue
+		}
+		if err := k.publish(key, []byte("{}")); err == nil || !strings.Contains(err.Error(), "partition 1 has no leader") {
+			t.Errorf("publish to the leaderless partition: got %v", err)
+		}
+		break
+	}
+	if len(k.leaders) != 2 {
+		t.Errorf("leaders dropped: %v", k.leaders)
+	}
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// listenerConf holds the settings of one --web.listen-address, in the
+// "listeners" section of CLAYMORE_CONFIG keyed by the address as given.
+type listenerConf struct {
+	// TLS settings, defaulting to the --web.tls-* flags.
+	TLSCertFile     string `json:"tls_cert_file"`
+	TLSKeyFile      string `json:"tls_key_file"`
+	TLSClientCAFile string `json:"tls_client_ca_file"`
+	// ReadOnly refuses everything but GET and HEAD, so the control API
+	// isn't reachable through this listener.
+	ReadOnly bool `json:"read_only"`
+	// ProtectReads overrides auth.protect_reads for this listener.
+	ProtectReads *bool `json:"protect_reads"`
+}
+
+func (c *expConf) listener(addr string) listenerConf {
+	if c.File == nil {
+		return listenerConf{}
+	}
+	return c.File.Listeners[addr]
+}
+
+// listen opens addr, a host:port or unix:/path for a unix socket. A stale
+// socket file from an earlier run is removed first.
+func listen(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// readOnly refuses requests that could change anything.
+func readOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "read-only listener", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveListeners serves h on every address, each with its listenerConf,
+// until one of them fails.
+func serveListeners(addrs []string, h http.Handler, o *serveOpts) error {
+	conf := currentConf()
+	errc := make(chan error, len(addrs))
+	for _, addr := range addrs {
+		lc := conf.listener(addr)
+		if len(lc.TLSCertFile) == 0 {
+			lc.TLSCertFile, lc.TLSKeyFile = o.tlsCertFile, o.tlsKeyFile
+		}
+		if len(lc.TLSClientCAFile) == 0 {
+			lc.TLSClientCAFile = o.tlsClientCAFile
+		}
+
+		handler := protectReads(h, lc.ProtectReads)
+		if lc.ReadOnly {
+			handler = readOnly(handler)
+		}
+		if o.accessLog {
+			handler = accessLog(handler)
+		}
+		server := &http.Server{Handler: handler}
+		if len(lc.TLSCertFile) != 0 {
+			tc, err := serverTLSConfig(lc.TLSClientCAFile)
+			if err != nil {
+				return err
+			}
+			server.TLSConfig = tc
+		}
+
+		l, err := listen(addr)
+		if err != nil {
+			return err
+		}
+		go func(lc listenerConf) {
+			if len(lc.TLSCertFile) != 0 {
+				errc <- server.ServeTLS(l, lc.TLSCertFile, lc.TLSKeyFile)
+			} else {
+				errc <- server.Serve(l)
+			}
+		}(lc)
+	}
+	return <-errc
+}
@@ -0,0 +1,140 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+)
+
+// setupLogging switches the log output to format, "text" for the plain
+// lines the exporter always wrote or "json" for one JSON object per line,
+// and to sink, "stderr", "journald" or "eventlog". In JSON or with another
+// sink, everything logged through the log package goes there too.
+func setupLogging(format, sink string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown log format %q, want text or json", format)
+	}
+
+	var w levelWriter
+	switch sink {
+	case "stderr":
+		if format == "json" {
+			slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+		}
+		return nil
+	case "journald":
+		j, err := openJournald()
+		if err != nil {
+			return fmt.Errorf("opening journald: %v", err)
+		}
+		w = j
+	case "eventlog":
+		e, err := openEventLog()
+		if err != nil {
+			return fmt.Errorf("opening the Windows Event Log: %v", err)
+		}
+		w = e
+	default:
+		return fmt.Errorf("unknown log sink %q, want stderr, journald or eventlog", sink)
+	}
+
+	// The platform logs add their own timestamps.
+	buf := &bytes.Buffer{}
+	opts := &slog.HandlerOptions{ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	}}
+	var h slog.Handler = slog.NewTextHandler(buf, opts)
+	if format == "json" {
+		h = slog.NewJSONHandler(buf, opts)
+	}
+	slog.SetDefault(slog.New(&sinkHandler{Handler: h, buf: buf, mu: &sync.Mutex{}, w: w}))
+	return nil
+}
+
+// levelWriter is a log sink that keeps the level of every message, like
+// journald's priorities or the Event Log's event types.
+type levelWriter interface {
+	writeLevel(level slog.Level, msg []byte) error
+}
+
+// sinkHandler formats records with the wrapped handler into buf and passes
+// each on to w with its level. Handlers derived with WithAttrs or
+// WithGroup share buf and mu.
+type sinkHandler struct {
+	slog.Handler
+	buf *bytes.Buffer
+	mu  *sync.Mutex
+	w   levelWriter
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.w.writeLevel(r.Level, bytes.TrimSuffix(h.buf.Bytes(), []byte("\n")))
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{Handler: h.Handler.WithAttrs(attrs), buf: h.buf, mu: h.mu, w: h.w}
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return &sinkHandler{Handler: h.Handler.WithGroup(name), buf: h.buf, mu: h.mu, w: h.w}
+}
+
+// logScrapeError logs a failed scrape of the rig at addr with fields to
+// filter on: the rig, the address dialed, the phase that failed (dial, rpc
+// or parse), how long it took and the class of the error.
+func logScrapeError(addr string, conf *expConf, phase string, d time.Duration, err error) {
+	class := errorClass(err)
+	if phase == "parse" {
+		class = "parse"
+	}
+	attrs := []any{
+		"rig", addr,
+		"address", dialAddr(addr, conf.Port),
+		"phase", phase,
+		"duration", d.String(),
+		"error_class", class,
+		"error", err.Error(),
+	}
+	if pe, ok := err.(*claymore.ParseError); ok {
+		attrs = append(attrs, "reason", pe.Reason)
+	}
+	slog.Error("scrape failed", attrs...)
+}
+
+// errorClass sorts err into a few classes worth alerting or filtering on.
+func errorClass(err error) string {
+	var ne net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "closed"
+	case errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	}
+	return "other"
+}
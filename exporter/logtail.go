@@ -0,0 +1,230 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var logEventsDesc = prometheus.NewDesc(
+	"claymore_log_events_total",
+	"Events matched in the miner's log since the exporter started, GPU empty for rig-wide ones",
+	[]string{"Rig", "event", "GPU"},
+	nil)
+
+// logTailConf has the exporter follow the miner's log on the rig.
+type logTailConf struct {
+	// Path is the log file. A glob follows the newest match, as Claymore
+	// starts a new log, e.g. 1539112800_log.txt, on every run.
+	Path string `json:"path"`
+	// Events maps event names to regexes matched against every new line,
+	// replacing defaultLogEvents. A regex with a (?P<gpu>\d+) group counts
+	// the event for that GPU index.
+	Events map[string]string `json:"events"`
+}
+
+// defaultLogEvents match Claymore's log lines.
+var defaultLogEvents = map[string]string{
+	"incorrect_share": `(?i)incorrect (ETH )?share`,
+	"gpu_hang":        `(?i)GPU ?#?(?P<gpu>\d+).*(hangs|hung|idle for)`,
+	"pool_reconnect":  `(?i)(reconnect|connection lost|disconnected)`,
+}
+
+// logTailInterval is how often the logs are read for new lines.
+const logTailInterval = time.Second
+
+// logTailer is where a rig's log was read up to.
+type logTailer struct {
+	path   string
+	file   *os.File
+	offset int64
+	// partial is a line still being written.
+	partial string
+}
+
+// logEvent is a counted event of a rig.
+type logEvent struct {
+	rig, event, gpu string
+}
+
+// logTails follows the logs of the rigs with log_tail, reading from their
+// end when first seen, and counts the events in them.
+type logTails struct {
+	mu      sync.Mutex
+	tailers map[string]*logTailer
+	counts  map[logEvent]float64
+}
+
+var minerLogs = &logTails{
+	tailers: make(map[string]*logTailer),
+	counts:  make(map[logEvent]float64),
+}
+
+// compileLogEvents compiles the configured events or the defaults.
+func compileLogEvents(events map[string]string) (map[string]*regexp.Regexp, error) {
+	if len(events) == 0 {
+		events = defaultLogEvents
+	}
+	res := make(map[string]*regexp.Regexp, len(events))
+	for name, expr := range events {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %v", name, err)
+		}
+		res[name] = re
+	}
+	return res, nil
+}
+
+// newestLog returns the newest file matching the pattern.
+func newestLog(pattern string) (string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	var newestTime time.Time
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil && !fi.IsDir() && fi.ModTime().After(newestTime) {
+			newest, newestTime = m, fi.ModTime()
+		}
+	}
+	if len(newest) == 0 {
+		return "", fmt.Errorf("no file matches %s", pattern)
+	}
+	return newest, nil
+}
+
+// run reads the logs once per logTailInterval, following the config.
+func (l *logTails) run() {
+	for range time.Tick(logTailInterval) {
+		conf := currentConf()
+		seen := make(map[string]bool)
+		if conf.File != nil {
+			for addr, rc := range conf.File.Rigs {
+				if rc.LogTail == nil {
+					continue
+				}
+				seen[addr] = true
+				if err := l.read(addr, rc.LogTail, conf); err != nil {
+					log.Printf("Tailing the log of %s: %v", addr, err)
+				}
+			}
+		}
+		l.mu.Lock()
+		for addr, t := range l.tailers {
+			if !seen[addr] {
+				t.file.Close()
+				delete(l.tailers, addr)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// read counts the events in the lines added to the rig's log since the
+// last read. A newer log matching the glob, or the file shrinking as when
+// it is rotated, starts over from its beginning.
+func (l *logTails) read(addr string, lc *logTailConf, conf *expConf) error {
+	path, err := newestLog(lc.Path)
+	if err != nil {
+		return err
+	}
+	events, err := compileLogEvents(lc.Events)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	t, ok := l.tailers[addr]
+	l.mu.Unlock()
+	if !ok || t.path != path {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		var offset int64
+		// The first log seen is read from its end, its past isn't news.
+		if !ok {
+			if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if ok {
+			t.file.Close()
+		}
+		t = &logTailer{path: path, file: f, offset: offset}
+		l.mu.Lock()
+		l.tailers[addr] = t
+		l.mu.Unlock()
+	}
+
+	fi, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < t.offset {
+		t.offset, t.partial = 0, ""
+	}
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(t.file)
+	for {
+		line, err := r.ReadString('\n')
+		t.offset += int64(len(line))
+		if err != nil {
+			t.partial += line
+			break
+		}
+		l.match(addr, t.partial+line, events, conf)
+		t.partial = ""
+	}
+	return nil
+}
+
+// match counts the events the line matches and publishes them.
+func (l *logTails) match(addr, line string, patterns map[string]*regexp.Regexp, conf *expConf) {
+	for name, re := range patterns {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ev := logEvent{rig: addr, event: name}
+		if i := re.SubexpIndex("gpu"); i > 0 {
+			if index, err := strconv.Atoi(m[i]); err == nil {
+				ev.gpu = conf.gpuName(addr, index, "")
+			}
+		}
+		l.mu.Lock()
+		l.counts[ev]++
+		l.mu.Unlock()
+		events.send(event{Type: "log", Time: time.Now(), Rig: addr, Event: name, GPU: ev.gpu, Line: strings.TrimRight(line, "\r\n")})
+	}
+}
+
+func (l *logTails) Describe(ch chan<- *prometheus.Desc) {
+	ch <- logEventsDesc
+}
+
+func (l *logTails) Collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ev, n := range l.counts {
+		ch <- prometheus.MustNewConstMetric(logEventsDesc,
+			prometheus.CounterValue,
+			n,
+			ev.rig, ev.event, ev.gpu)
+	}
+}
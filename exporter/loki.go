@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// lokiPushPath is Loki's push API, added to the configured URL.
+const lokiPushPath = "/loki/api/v1/push"
+
+// lokiPublisher pushes events to Loki as log lines, one stream per rig and
+// event, so they can sit next to the rig's metrics in Grafana. Poll results
+// are left out, they duplicate the metrics. Credentials in the URL are sent
+// as basic auth.
+type lokiPublisher struct {
+	url    string
+	user   *url.Userinfo
+	tenant string
+}
+
+func newLokiPublisher(serverURL, tenant string) (*lokiPublisher, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("bad Loki URL %q", serverURL)
+	}
+	l := &lokiPublisher{user: u.User, tenant: tenant}
+	u.User = nil
+	if !strings.HasSuffix(u.Path, lokiPushPath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + lokiPushPath
+	}
+	l.url = u.String()
+	return l, nil
+}
+
+func (l *lokiPublisher) String() string { return "Loki" }
+
+// lokiStream is a stream of Loki's push request: its labels and its
+// [timestamp in ns, line] values.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiLabels returns the stream labels of e: the rig, the event type and
+// the alert, change or log event. GPUs stay in the line to keep the
+// streams few.
+func lokiLabels(key string, e *event) map[string]string {
+	labels := map[string]string{"job": "claymore_exporter", "rig": key, "type": e.Type}
+	for _, name := range []string{e.Alert, e.Change, e.Event} {
+		if len(name) != 0 {
+			labels["event"] = name
+		}
+	}
+	return labels
+}
+
+func (l *lokiPublisher) publish(key string, msg []byte) error {
+	var e event
+	if err := json.Unmarshal(msg, &e); err != nil {
+		return err
+	}
+	if e.Type == "poll" {
+		return nil
+	}
+	body, _ := json.Marshal(map[string][]lokiStream{"streams": {{
+		Stream: lokiLabels(key, &e),
+		Values: [][2]string{{strconv.FormatInt(e.Time.UnixNano(), 10), string(msg)}},
+	}}})
+
+	req, err := http.NewRequest("POST", l.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.user != nil {
+		pass, _ := l.user.Password()
+		req.SetBasicAuth(l.user.Username(), pass)
+	}
+	if len(l.tenant) != 0 {
+		req.Header.Set("X-Scope-OrgID", l.tenant)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST %s: %s %s", l.url, resp.Status, strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	shareLuckDesc = prometheus.NewDesc(
+		"claymore_share_luck_ratio",
+		"Shares the rig found over the luck window divided by the shares its hashrate should have found, 1 for average luck",
+		[]string{"Rig"},
+		nil)
+
+	sharesExpectedDesc = prometheus.NewDesc(
+		"claymore_shares_expected",
+		"Shares the rig's hashrate should have found over the luck window at the pool's share difficulty",
+		[]string{"Rig"},
+		nil)
+)
+
+// shareLuck is a rig's luck over the luck window and when it was computed.
+type shareLuck struct {
+	found, expected float64
+	time            time.Time
+}
+
+// shareDifficulty returns the pool share difficulty, in hashes per share,
+// of the rig mining coin: the rig's own, the coin's, or 0 if neither is
+// configured.
+func (c *expConf) shareDifficulty(addr, coin string) float64 {
+	if d := c.rig(addr).ShareDifficulty; d > 0 {
+		return d
+	}
+	if c.File != nil {
+		return c.File.Coins[coin].ShareDifficulty
+	}
+	return 0
+}
+
+// countShares returns the shares found and expected at difficulty between
+// consecutive samples in which the rig was up. A miner restart resets its
+// share counter, the shares after it count from zero.
+func countShares(samples []historySample, difficulty float64) (found, expected float64) {
+	for i := 1; i < len(samples); i++ {
+		prev, s := samples[i-1], samples[i]
+		if prev.Down || s.Down {
+			continue
+		}
+		if s.Uptime < prev.Uptime || s.EthFound < prev.EthFound {
+			found += s.EthFound
+		} else {
+			found += s.EthFound - prev.EthFound
+		}
+		// Claymore reports kH/s; the interval runs at the mean hashrate.
+		rate := (prev.TotalRate + s.TotalRate) / 2 * 1000
+		expected += rate * s.Time.Sub(prev.Time).Seconds() / difficulty
+	}
+	return found, expected
+}
+
+// luckMetrics compares the shares the rig found over the last luckWindow
+// of history with those its hashrate should have found. Nothing is
+// exported without a share difficulty or while less than one share is
+// expected, where luck is mostly noise.
+func (c *ClaymoreStatsCollector) luckMetrics(addr string, conf *expConf, stats *claymore.Stats, now time.Time) []prometheus.Metric {
+	if c.history == nil || c.luckWindow <= 0 {
+		return nil
+	}
+	coin, _ := conf.coins(addr, stats)
+	difficulty := conf.shareDifficulty(addr, coin)
+	if difficulty <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	l, ok := c.lucks[addr]
+	c.mu.Unlock()
+	if !ok || now.Sub(l.time) >= baselineRefresh {
+		l = shareLuck{time: now}
+		l.found, l.expected = countShares(c.history.query(addr, now.Add(-c.luckWindow)), difficulty)
+		c.mu.Lock()
+		c.lucks[addr] = l
+		c.mu.Unlock()
+	}
+	if l.expected < 1 {
+		return nil
+	}
+	return []prometheus.Metric{
+		prometheus.MustNewConstMetric(shareLuckDesc,
+			prometheus.GaugeValue,
+			l.found/l.expected,
+			addr),
+		prometheus.MustNewConstMetric(sharesExpectedDesc,
+			prometheus.GaugeValue,
+			l.expected,
+			addr),
+	}
+}
@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rigMaintenanceDesc = prometheus.NewDesc(
+		"claymore_rig_maintenance",
+		"1 while the rig is in maintenance and its alerts are suppressed",
+		[]string{"Rig"},
+		nil)
+
+	rigNoteDesc = prometheus.NewDesc(
+		"claymore_rig_note_info",
+		"Note about the rig, from the config file or the maintenance API",
+		[]string{"Rig", "note"},
+		nil)
+)
+
+// maintenanceState is a rig's maintenance mode as set through the API.
+type maintenanceState struct {
+	On    bool      `json:"maintenance"`
+	Note  string    `json:"note,omitempty"`
+	By    string    `json:"by,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// maintenanceStore keeps the maintenance modes set through the API. They
+// override the config file's until they are deleted or the exporter
+// restarts.
+type maintenanceStore struct {
+	mu   sync.Mutex
+	rigs map[string]maintenanceState
+}
+
+var maintenance = &maintenanceStore{rigs: make(map[string]maintenanceState)}
+
+// get returns the rig's maintenance mode: the API's, or the config file's.
+func (m *maintenanceStore) get(conf *expConf, rig string) maintenanceState {
+	m.mu.Lock()
+	st, ok := m.rigs[rig]
+	m.mu.Unlock()
+	if ok {
+		return st
+	}
+	rc := conf.rig(rig)
+	return maintenanceState{On: rc.Maintenance, Note: rc.Note}
+}
+
+func (m *maintenanceStore) set(rig string, st maintenanceState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rigs[rig] = st
+}
+
+// clear drops the rig's mode set through the API, so the config file's
+// applies again.
+func (m *maintenanceStore) clear(rig string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rigs, rig)
+}
+
+// inMaintenance reports whether the rig's alerts are suppressed.
+func inMaintenance(rig string) bool {
+	return maintenance.get(currentConf(), rig).On
+}
+
+func (m *maintenanceStore) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rigMaintenanceDesc
+	ch <- rigNoteDesc
+}
+
+func (m *maintenanceStore) Collect(ch chan<- prometheus.Metric) {
+	conf := currentConf()
+	for _, rig := range conf.Dial_Addr {
+		st := m.get(conf, rig)
+		ch <- prometheus.MustNewConstMetric(rigMaintenanceDesc,
+			prometheus.GaugeValue,
+			boolValue(st.On),
+			rig)
+		if len(st.Note) != 0 {
+			ch <- prometheus.MustNewConstMetric(rigNoteDesc,
+				prometheus.GaugeValue,
+				1,
+				rig, st.Note)
+		}
+	}
+}
+
+// maintenanceHandler serves /api/v1/rigs/{rig}/maintenance: GET shows the
+// rig's mode, PUT with {"note": "..."} puts it in maintenance and DELETE
+// drops what PUT set, leaving the rig to the config file. Changes need the
+// control scope.
+func maintenanceHandler(w http.ResponseWriter, r *http.Request, conf *expConf, rig string) {
+	var action string
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(maintenance.get(conf, rig))
+		return
+	case http.MethodPut:
+		action = "maintenance_on"
+	case http.MethodDelete:
+		action = "maintenance_off"
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who, denied := requireScope(w, r, conf, scopeControl)
+	if len(denied) != 0 {
+		audit(r, auditEvent{Who: who, Action: action, Rig: rig, Result: denied})
+		return
+	}
+	if r.Method == http.MethodDelete {
+		maintenance.clear(rig)
+		audit(r, auditEvent{Who: who, Action: action, Rig: rig, Result: auditOK})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			audit(r, auditEvent{Who: who, Action: action, Rig: rig, Result: auditError})
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	maintenance.set(rig, maintenanceState{On: true, Note: req.Note, By: who, Since: time.Now()})
+	var params []string
+	if len(req.Note) != 0 {
+		params = []string{req.Note}
+	}
+	audit(r, auditEvent{Who: who, Action: action, Rig: rig, Params: params, Result: auditOK})
+	w.WriteHeader(http.StatusNoContent)
+}
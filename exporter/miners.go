@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultMiner is the miner type of rigs that don't name one.
+const defaultMiner = "claymore"
+
+// metricPrefix is what a miner type's prefix replaces in metric names.
+const metricPrefix = "claymore_"
+
+// minerConf configures how the series of a miner type's rigs are exported.
+type minerConf struct {
+	// Prefix replaces the claymore_ of the rigs' metric names, e.g.
+	// "xmrig_" for CPU miners.
+	Prefix string `json:"prefix"`
+}
+
+var validPrefix = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// miner returns the rig's miner type, from the rig, its group, or
+// defaultMiner.
+func (c *expConf) miner(addr string) string {
+	rc := c.rig(addr)
+	if len(rc.Miner) != 0 {
+		return rc.Miner
+	}
+	if m := c.group(rc.Group).Miner; len(m) != 0 {
+		return m
+	}
+	return defaultMiner
+}
+
+// minerGatherer renames and labels the series of each rig by its miner
+// type: the miner_label config adds a miner label to every series with a
+// Rig label, and a miner's prefix replaces claymore_ in their names.
+// Series without a Rig label pass through unchanged.
+type minerGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g minerGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	conf := currentConf()
+	if conf.File == nil || (!conf.File.MinerLabel && len(conf.File.Miners) == 0) {
+		return mfs, err
+	}
+
+	byName := make(map[string]*dto.MetricFamily, len(mfs))
+	family := func(name string, like *dto.MetricFamily) *dto.MetricFamily {
+		mf, ok := byName[name]
+		if !ok {
+			mf = &dto.MetricFamily{Name: proto.String(name), Help: like.Help, Type: like.Type}
+			byName[name] = mf
+		}
+		return mf
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			rig, ok := metricLabel(m, "Rig")
+			if !ok {
+				family(mf.GetName(), mf).Metric = append(family(mf.GetName(), mf).Metric, m)
+				continue
+			}
+			miner := conf.miner(rig)
+			name := mf.GetName()
+			if prefix := conf.File.Miners[miner].Prefix; len(prefix) != 0 && strings.HasPrefix(name, metricPrefix) {
+				name = prefix + strings.TrimPrefix(name, metricPrefix)
+			}
+			if conf.File.MinerLabel {
+				setLabel(m, "miner", miner)
+			}
+			mf := family(name, mf)
+			mf.Metric = append(mf.Metric, m)
+		}
+	}
+
+	out := make([]*dto.MetricFamily, 0, len(byName))
+	for _, mf := range byName {
+		out = append(out, mf)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	return out, err
+}
+
+// setLabel sets the label on m, replacing one it already has, as a series
+// can't carry a label twice.
+func setLabel(m *dto.Metric, name, value string) {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			l.Value = proto.String(value)
+			return
+		}
+	}
+	m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+}
+
+func metricLabel(m *dto.Metric, name string) (string, bool) {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue(), true
+		}
+	}
+	return "", false
+}
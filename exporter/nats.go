@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsPublisher publishes to a NATS subject over the plain text client
+// protocol. It connects on first use and again after an error; messages
+// published while the server is unreachable are lost.
+type natsPublisher struct {
+	url     string
+	subject string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newNATSPublisher(serverURL, subject string) (*natsPublisher, error) {
+	if len(subject) == 0 || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("bad NATS subject %q", subject)
+	}
+	if _, err := url.Parse(serverURL); err != nil {
+		return nil, err
+	}
+	return &natsPublisher{url: serverURL, subject: subject}, nil
+}
+
+func (n *natsPublisher) String() string { return "NATS" }
+
+// connect opens a connection and starts answering the server's PINGs,
+// which it sends to find dead clients.
+func (n *natsPublisher) connect() (net.Conn, error) {
+	u, err := url.Parse(n.url)
+	if err != nil {
+		return nil, err
+	}
+	host, port := splitTarget(u.Host, "4222")
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	info, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("no INFO from server: %v", err)
+	}
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "claymore_exporter", "lang": "go"}
+	if u.User != nil {
+		pass, ok := u.User.Password()
+		if ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(reply, "PONG") {
+		conn.Close()
+		return nil, fmt.Errorf("server refused connection: %s", strings.TrimSpace(reply))
+	}
+	conn.SetDeadline(time.Time{})
+
+	go n.read(conn, r)
+	return conn, nil
+}
+
+// read answers PINGs until the connection fails, then drops it.
+func (n *natsPublisher) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			n.mu.Lock()
+			_, err = conn.Write([]byte("PONG\r\n"))
+			n.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			err = fmt.Errorf("%s", strings.TrimSpace(line))
+		}
+		if err != nil {
+			break
+		}
+	}
+	n.mu.Lock()
+	if n.conn == conn {
+		n.conn = nil
+	}
+	n.mu.Unlock()
+	conn.Close()
+}
+
+func (n *natsPublisher) publish(key string, msg []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		conn, err := n.connect()
+		if err != nil {
+			return err
+		}
+		n.conn = conn
+	}
+	n.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := fmt.Fprintf(n.conn, "PUB %s %d\r\n%s\r\n", n.subject, len(msg), msg)
+	if err != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	return err
+}
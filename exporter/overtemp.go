@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gpuTempLimitDesc = prometheus.NewDesc(
+		"claymore_gpu_temperature_limit_celsius",
+		"Temperature limit configured for the GPU",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuOvertempDesc = prometheus.NewDesc(
+		"claymore_gpu_overtemp",
+		"1 if the GPU's last temperature reading was above its limit",
+		[]string{"Rig", "GPU"},
+		nil)
+
+	gpuOvertempSecondsDesc = prometheus.NewDesc(
+		"claymore_gpu_overtemp_seconds_total",
+		"Time the GPU spent above its temperature limit, between readings",
+		[]string{"Rig", "GPU"},
+		nil)
+)
+
+// overtempMaxGap is the longest time between two readings that counts as
+// over the limit. A rig unreachable for longer may have cooled down.
+const overtempMaxGap = 5 * time.Minute
+
+// gpuOvertempState is what limit tracking remembers of a rig between
+// scrapes.
+type gpuOvertempState struct {
+	time    time.Time
+	over    map[string]bool
+	seconds map[string]float64
+}
+
+// tempLimit returns the temperature limit of the rig's GPU at index, from
+// gpu_temp_limits or else the rig's temp_limit, or 0 if it has none.
+func (c *expConf) tempLimit(addr string, index int) float64 {
+	rc := c.rig(addr)
+	if limit, ok := rc.GPUTempLimits[strconv.Itoa(index)]; ok {
+		return limit
+	}
+	return rc.TempLimit
+}
+
+// overtempMetrics compares the GPUs' temperatures with their limits and
+// adds the time since the previous reading to those that were over it
+// then. The poller makes the readings regular.
+func (c *ClaymoreStatsCollector) overtempMetrics(addr string, conf *expConf, stats *claymore.Stats, now time.Time) []prometheus.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, ok := c.overtemps[addr]
+	if !ok {
+		st = &gpuOvertempState{over: make(map[string]bool), seconds: make(map[string]float64)}
+		c.overtemps[addr] = st
+	}
+	elapsed := now.Sub(st.time)
+
+	var metrics []prometheus.Metric
+	for i, gpu := range stats.GPUs {
+		limit := conf.tempLimit(addr, i)
+		if limit <= 0 {
+			continue
+		}
+		if st.over[gpu.Name] && elapsed <= overtempMaxGap {
+			st.seconds[gpu.Name] += elapsed.Seconds()
+		}
+		temp, _ := strconv.ParseFloat(gpu.Temp, 64)
+		over := temp > limit
+		switch {
+		case over && !st.over[gpu.Name]:
+			events.alert(addr, gpu.Name, alertGPUOvertemp, temp, limit)
+			c.noteIncident(addr, gpu.Name, alertGPUOvertemp)
+		case !over && st.over[gpu.Name]:
+			events.alert(addr, gpu.Name, alertGPUOvertempEnded, temp, limit)
+		}
+		st.over[gpu.Name] = over
+
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(gpuTempLimitDesc,
+				prometheus.GaugeValue,
+				limit,
+				addr, gpu.Name),
+			prometheus.MustNewConstMetric(gpuOvertempDesc,
+				prometheus.GaugeValue,
+				boolValue(st.over[gpu.Name]),
+				addr, gpu.Name),
+			prometheus.MustNewConstMetric(gpuOvertempSecondsDesc,
+				prometheus.CounterValue,
+				st.seconds[gpu.Name],
+				addr, gpu.Name))
+	}
+	st.time = now
+	return metrics
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var pollIntervalDesc = prometheus.NewDesc(
+	"claymore_poll_interval_seconds",
+	"How often the background poller scrapes the rig",
+	[]string{"Rig"},
+	nil)
+
+// pollResolution is how often the poller checks which rigs are due.
+const pollResolution = time.Second
+
+// poll scrapes every rig once per its poll interval, interval unless the
+// config file sets another for the rig or its group, independently of
+// Prometheus, so values computed across scrapes (the hashrate averages)
+// get regular samples, and pushes them to sinks. Results land in the same
+// cache /metrics serves from, so with --scrape.min-interval above the poll
+// interval Prometheus only ever reads what the poller got.
+func (c *ClaymoreStatsCollector) poll(interval time.Duration, sinks []pollSink) {
+	next := make(map[string]time.Time)
+	for now := range time.Tick(pollResolution) {
+		// On HA standby, the rigs are all due once this exporter leads.
+		if !isLeader() {
+			continue
+		}
+		conf := currentConf()
+
+		var due []string
+		rigs := make(map[string]bool, len(conf.Dial_Addr))
+		for _, addr := range conf.Dial_Addr {
+			rigs[addr] = true
+			if now.Before(next[addr]) {
+				continue
+			}
+			next[addr] = now.Add(conf.pollInterval(addr, interval))
+			due = append(due, addr)
+		}
+		for addr := range next {
+			if !rigs[addr] {
+				delete(next, addr)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		// A slow rig doesn't hold up the others; a rig still being
+		// scraped when it is due again shares the scrape in flight.
+		ctx, span := tracer.Start(context.Background(), "poll")
+		var wg sync.WaitGroup
+		for _, addr := range due {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				s := c.refresh(ctx, addr, conf)
+				if len(sinks) != 0 {
+					c.push(sinks, addr, s)
+				}
+			}(addr)
+		}
+		go func() {
+			wg.Wait()
+			span.End()
+		}()
+	}
+}
+
+// pollSink is a system the poller pushes every poll's readings to.
+type pollSink interface {
+	// emit sends the rig's up state and its newest sample, which only
+	// holds readings if the rig is up.
+	emit(rig string, up bool, s historySample) error
+	String() string
+}
+
+// push sends the rig's newest sample to the sinks after a poll.
+func (c *ClaymoreStatsCollector) push(sinks []pollSink, addr string, s rigScrape) {
+	up := s.ok && !c.stale(addr, s, time.Now())
+	c.mu.Lock()
+	sample := c.latest[addr]
+	c.mu.Unlock()
+	for _, sink := range sinks {
+		if err := sink.emit(addr, up, sample); err != nil {
+			log.Printf("Pushing %s to %s: %v", addr, sink, err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolReachableDesc = prometheus.NewDesc(
+		"claymore_pool_reachable",
+		"1 if the exporter could open a TCP connection to the rig's pool",
+		[]string{"Rig", "pool"},
+		nil)
+
+	poolRTTDesc = prometheus.NewDesc(
+		"claymore_pool_rtt_seconds",
+		"Time to open a TCP connection to the rig's pool",
+		[]string{"Rig", "pool"},
+		nil)
+
+	poolInfoDesc = prometheus.NewDesc(
+		"claymore_pool_info",
+		"Pool the rig mines a coin on, with wallet and worker where known",
+		[]string{"Rig", "coin", "pool", "wallet", "worker"},
+		nil)
+
+	stratumUpDesc = prometheus.NewDesc(
+		"claymore_pool_stratum_up",
+		"1 if the pool answered a stratum mining.subscribe without error",
+		[]string{"Rig", "pool"},
+		nil)
+
+	stratumLoginDesc = prometheus.NewDesc(
+		"claymore_pool_stratum_login_success",
+		"1 if the pool accepted mining.authorize for the rig's configured stratum user",
+		[]string{"Rig", "pool"},
+		nil)
+
+	stratumLatencyDesc = prometheus.NewDesc(
+		"claymore_pool_stratum_response_seconds",
+		"Time from sending mining.subscribe to the pool's answer",
+		[]string{"Rig", "pool"},
+		nil)
+)
+
+const poolProbeTimeout = 3 * time.Second
+
+// poolEntry is one pool of the miner's pool field, split into the
+// host:port to connect to and the wallet and worker some pools take in
+// the path, e.g. eth-eu1.nanopool.org:9999/0xabc.../rig01.
+type poolEntry struct {
+	Addr   string
+	Wallet string
+	Worker string
+}
+
+// splitUser splits a stratum user of the form wallet.worker or
+// wallet/worker.
+func splitUser(user string) (wallet, worker string) {
+	if i := strings.IndexAny(user, "./"); i >= 0 {
+		return user[:i], user[i+1:]
+	}
+	return user, ""
+}
+
+// parsePools splits a list of pools separated by ';'.
+func parsePools(field string) []poolEntry {
+	var pools []poolEntry
+	for _, p := range strings.Split(field, ";") {
+		p = strings.TrimSpace(p)
+		if i := strings.Index(p, "://"); i >= 0 {
+			p = p[i+3:]
+		}
+
+		var e poolEntry
+		if i := strings.Index(p, "/"); i >= 0 {
+			e.Wallet, e.Worker = splitUser(strings.Trim(p[i+1:], "/"))
+			p = p[:i]
+		}
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			continue
+		}
+		e.Addr = p
+		pools = append(pools, e)
+	}
+	return pools
+}
+
+// splitPools returns the host:port addresses of the miner's pool field.
+func splitPools(field string) []string {
+	var pools []string
+	for _, e := range parsePools(field) {
+		pools = append(pools, e.Addr)
+	}
+	return pools
+}
+
+// poolInfoMetrics exports the rig's pools, labelled with the coin mined on
+// them, with the wallet and worker taken from the pool string or, failing
+// that, the configured stratum user.
+func poolInfoMetrics(addr string, conf *expConf, stats *claymore.Stats) []prometheus.Metric {
+	cfgWallet, cfgWorker := splitUser(conf.rig(addr).StratumUser)
+	primary, secondary := conf.coins(addr, stats)
+
+	var metrics []prometheus.Metric
+	for _, p := range []struct{ coin, field string }{{primary, stats.Pool}, {secondary, stats.SecondaryPool}} {
+		for _, e := range parsePools(p.field) {
+			if len(e.Wallet) == 0 {
+				e.Wallet, e.Worker = cfgWallet, cfgWorker
+			}
+			metrics = append(metrics, prometheus.MustNewConstMetric(poolInfoDesc,
+				prometheus.GaugeValue,
+				1,
+				addr, p.coin, e.Addr, e.Wallet, e.Worker))
+		}
+	}
+	return metrics
+}
+
+// probePool reports whether pool accepts TCP connections and how long the
+// handshake took.
+func probePool(pool string) (bool, time.Duration) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", pool, poolProbeTimeout)
+	rtt := time.Since(start)
+	if err != nil {
+		return false, rtt
+	}
+	conn.Close()
+	return true, rtt
+}
+
+type stratumRequest struct {
+	ID     int      `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+type stratumResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func (r *stratumResponse) ok() bool {
+	res := strings.TrimSpace(string(r.Result))
+	errv := strings.TrimSpace(string(r.Error))
+	return len(res) != 0 && res != "null" && res != "false" && (len(errv) == 0 || errv == "null")
+}
+
+// stratumCall sends one request and waits for the response with the same
+// id, skipping notifications the pool pushes in between.
+func stratumCall(conn net.Conn, rd *bufio.Reader, req stratumRequest) (*stratumResponse, error) {
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var resp stratumResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return nil, fmt.Errorf("decoding %s response: %v", req.Method, err)
+		}
+		if resp.ID == req.ID {
+			return &resp, nil
+		}
+	}
+}
+
+// stratumCheck performs a minimal stratum handshake: mining.subscribe and,
+// if user is set, mining.authorize. latency is the subscribe round trip.
+func stratumCheck(pool, user string) (subscribed, authorized bool, latency time.Duration, err error) {
+	conn, err := net.DialTimeout("tcp", pool, poolProbeTimeout)
+	if err != nil {
+		return false, false, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * poolProbeTimeout))
+	rd := bufio.NewReader(conn)
+
+	start := time.Now()
+	resp, err := stratumCall(conn, rd, stratumRequest{
+		ID:     1,
+		Method: "mining.subscribe",
+		Params: []string{"claymore_exporter", "EthereumStratum/1.0.0"},
+	})
+	if err != nil {
+		return false, false, 0, err
+	}
+	latency = time.Since(start)
+	if !resp.ok() {
+		return false, false, latency, fmt.Errorf("mining.subscribe refused: %s", resp.Error)
+	}
+	if len(user) == 0 {
+		return true, false, latency, nil
+	}
+
+	resp, err = stratumCall(conn, rd, stratumRequest{
+		ID:     2,
+		Method: "mining.authorize",
+		Params: []string{user, "x"},
+	})
+	if err != nil {
+		return true, false, latency, err
+	}
+	return true, resp.ok(), latency, nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func rigPools(addr string, conf *expConf, stats *claymore.Stats) []string {
+	if pools := conf.rig(addr).Pools; len(pools) != 0 {
+		return pools
+	}
+	return splitPools(stats.Pool + ";" + stats.SecondaryPool)
+}
+
+// stratumMetrics runs a stratum handshake against each of the rig's pools.
+func stratumMetrics(addr string, conf *expConf, stats *claymore.Stats) []prometheus.Metric {
+	user := conf.rig(addr).StratumUser
+
+	var metrics []prometheus.Metric
+	for _, pool := range rigPools(addr, conf, stats) {
+		subscribed, authorized, latency, err := stratumCheck(pool, user)
+		if err != nil {
+			log.Printf("Stratum check of %s for %s: %v", pool, addr, err)
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(stratumUpDesc,
+			prometheus.GaugeValue,
+			boolValue(subscribed),
+			addr, pool))
+		if subscribed {
+			metrics = append(metrics, prometheus.MustNewConstMetric(stratumLatencyDesc,
+				prometheus.GaugeValue,
+				latency.Seconds(),
+				addr, pool))
+		}
+		if subscribed && len(user) != 0 {
+			metrics = append(metrics, prometheus.MustNewConstMetric(stratumLoginDesc,
+				prometheus.GaugeValue,
+				boolValue(authorized),
+				addr, pool))
+		}
+	}
+	return metrics
+}
+
+// poolMetrics probes the pools of a rig, the configured ones if any and
+// the ones the miner reports otherwise.
+func poolMetrics(addr string, conf *expConf, stats *claymore.Stats) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, pool := range rigPools(addr, conf, stats) {
+		ok, rtt := probePool(pool)
+		metrics = append(metrics, prometheus.MustNewConstMetric(poolReachableDesc,
+			prometheus.GaugeValue,
+			boolValue(ok),
+			addr, pool))
+		if ok {
+			metrics = append(metrics, prometheus.MustNewConstMetric(poolRTTDesc,
+				prometheus.GaugeValue,
+				rtt.Seconds(),
+				addr, pool))
+		}
+	}
+	return metrics
+}
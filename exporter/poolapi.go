@@ -0,0 +1,360 @@
+package exporter
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolHashrateDesc = prometheus.NewDesc(
+		"claymore_hashrate_pool_effective_hashes_per_second",
+		"Effective hashrate of the rig's worker as reported by the pool's API",
+		[]string{"Rig"},
+		nil)
+
+	poolDiscrepancyDesc = prometheus.NewDesc(
+		"claymore_hashrate_pool_discrepancy_ratio",
+		"Relative difference of the pool's effective hashrate from the rig's 30m average, -0.1 when the pool sees 10% less",
+		[]string{"Rig"},
+		nil)
+
+	payoutLastTimeDesc = prometheus.NewDesc(
+		"claymore_pool_payout_last_timestamp_seconds",
+		"When the pool last paid the wallet",
+		[]string{"coin", "wallet"},
+		nil)
+
+	payoutLastAmountDesc = prometheus.NewDesc(
+		"claymore_pool_payout_last_amount_coins",
+		"Amount of the pool's last payout to the wallet",
+		[]string{"coin", "wallet"},
+		nil)
+
+	payoutsTotalDesc = prometheus.NewDesc(
+		"claymore_pool_payouts_coins_total",
+		"Payouts to the wallet the pool listed since the exporter started watching it",
+		[]string{"coin", "wallet"},
+		nil)
+)
+
+// poolAPIConf describes the pool's endpoint listing a wallet's workers
+// with their effective hashrates. The defaults fit Ethermine's API.
+type poolAPIConf struct {
+	// URL is the endpoint with {wallet} in it, e.g.
+	// "https://api.ethermine.org/miner/{wallet}/workers". Empty disables
+	// the pool-side hashrate.
+	URL string `json:"url"`
+	// Workers is the dotted path of the array of workers in the reply,
+	// "data" by default, "" for a top-level array.
+	Workers *string `json:"workers"`
+	// Name and Hashrate are the worker fields holding its name and its
+	// effective hashrate in H/s, "worker" and "currentHashrate" by
+	// default.
+	Name     string `json:"name"`
+	Hashrate string `json:"hashrate"`
+
+	// PayoutsURL is the endpoint listing the wallet's payouts, with
+	// {wallet} in it, e.g. "https://api.ethermine.org/miner/{wallet}/payouts".
+	// Empty disables payout tracking.
+	PayoutsURL string `json:"payouts_url"`
+	// Payouts is the dotted path of the array of payouts, "data" by
+	// default. PaidOn and Amount are the payout fields holding its time in
+	// Unix seconds and its amount, "paidOn" and "amount" by default.
+	Payouts *string `json:"payouts"`
+	PaidOn  string  `json:"paid_on"`
+	Amount  string  `json:"amount"`
+	// AmountDivisor converts amounts to coins, 1e18 (wei) by default.
+	AmountDivisor float64 `json:"amount_divisor"`
+}
+
+// walletPayouts is what the pool paid a wallet.
+type walletPayouts struct {
+	lastTime   int64
+	lastAmount float64
+	total      float64
+}
+
+// poolWallet is a wallet of a coin.
+type poolWallet struct {
+	coin, wallet string
+}
+
+// poolWorkers keeps the effective hashrates of the workers of the wallets
+// the rigs mine to and the wallets' payouts, fetched in the background.
+type poolWorkers struct {
+	mu        sync.Mutex
+	fetched   map[poolWallet]time.Time
+	hashrates map[poolWallet]map[string]float64
+	payouts   map[poolWallet]*walletPayouts
+}
+
+var poolStats = &poolWorkers{
+	fetched:   make(map[poolWallet]time.Time),
+	hashrates: make(map[poolWallet]map[string]float64),
+	payouts:   make(map[poolWallet]*walletPayouts),
+}
+
+// hashrate returns the worker's effective hashrate in H/s, and asks for the
+// wallet to be fetched if it isn't yet.
+func (p *poolWorkers) hashrate(coin, wallet, worker string) (float64, bool) {
+	w := poolWallet{coin, wallet}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.fetched[w]; !ok {
+		p.fetched[w] = time.Time{}
+	}
+	rate, ok := p.hashrates[w][worker]
+	return rate, ok
+}
+
+// refresh fetches each wallet asked for once per interval, new ones within
+// seconds. Errors keep the previous hashrates.
+func (p *poolWorkers) refresh(interval time.Duration) {
+	for now := range time.Tick(10 * time.Second) {
+		conf := currentConf()
+		if conf.File == nil {
+			continue
+		}
+		var due []poolWallet
+		p.mu.Lock()
+		for w, t := range p.fetched {
+			if now.Sub(t) >= interval {
+				due = append(due, w)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, w := range due {
+			api := conf.File.Coins[w.coin].PoolAPI
+			if api == nil {
+				continue
+			}
+			p.mu.Lock()
+			p.fetched[w] = now
+			p.mu.Unlock()
+
+			if len(api.URL) != 0 {
+				rates, err := fetchPoolWorkers(api, w.wallet)
+				if err != nil {
+					log.Printf("Fetching %s workers of %s: %v", w.coin, w.wallet, err)
+				} else {
+					p.mu.Lock()
+					p.hashrates[w] = rates
+					p.mu.Unlock()
+				}
+			}
+			if len(api.PayoutsURL) == 0 {
+				continue
+			}
+			payouts, err := fetchPayouts(api, w.wallet)
+			if err != nil {
+				log.Printf("Fetching %s payouts of %s: %v", w.coin, w.wallet, err)
+				continue
+			}
+			p.mu.Lock()
+			p.addPayouts(w, payouts)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// fetchPoolWorkers returns the effective hashrates of the wallet's workers
+// by name.
+func fetchPoolWorkers(api *poolAPIConf, wallet string) (map[string]float64, error) {
+	var reply interface{}
+	if err := getJSON(strings.Replace(api.URL, "{wallet}", wallet, -1), &reply); err != nil {
+		return nil, err
+	}
+
+	path := "data"
+	if api.Workers != nil {
+		path = *api.Workers
+	}
+	workers, err := jsonArray(reply, path)
+	if err != nil {
+		return nil, err
+	}
+
+	nameField, rateField := api.Name, api.Hashrate
+	if len(nameField) == 0 {
+		nameField = "worker"
+	}
+	if len(rateField) == 0 {
+		rateField = "currentHashrate"
+	}
+	rates := make(map[string]float64)
+	for _, w := range workers {
+		obj, _ := w.(map[string]interface{})
+		name, _ := obj[nameField].(string)
+		rate, ok := obj[rateField].(float64)
+		if len(name) != 0 && ok {
+			rates[name] = rate
+		}
+	}
+	return rates, nil
+}
+
+// jsonArray follows the dotted path in a decoded JSON reply to an array.
+func jsonArray(reply interface{}, path string) ([]interface{}, error) {
+	if len(path) != 0 {
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := reply.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("no %q in reply", path)
+			}
+			reply = obj[key]
+		}
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%q is not an array", path)
+	}
+	return items, nil
+}
+
+// payout is one payout to a wallet, in coins.
+type payout struct {
+	time   int64
+	amount float64
+}
+
+// fetchPayouts returns the payouts the pool lists for the wallet.
+func fetchPayouts(api *poolAPIConf, wallet string) ([]payout, error) {
+	var reply interface{}
+	if err := getJSON(strings.Replace(api.PayoutsURL, "{wallet}", wallet, -1), &reply); err != nil {
+		return nil, err
+	}
+	path := "data"
+	if api.Payouts != nil {
+		path = *api.Payouts
+	}
+	items, err := jsonArray(reply, path)
+	if err != nil {
+		return nil, err
+	}
+
+	timeField, amountField, divisor := api.PaidOn, api.Amount, api.AmountDivisor
+	if len(timeField) == 0 {
+		timeField = "paidOn"
+	}
+	if len(amountField) == 0 {
+		amountField = "amount"
+	}
+	if divisor <= 0 {
+		divisor = 1e18
+	}
+	var payouts []payout
+	for _, item := range items {
+		obj, _ := item.(map[string]interface{})
+		t, ok1 := obj[timeField].(float64)
+		amount, ok2 := obj[amountField].(float64)
+		if ok1 && ok2 {
+			payouts = append(payouts, payout{time: int64(t), amount: amount / divisor})
+		}
+	}
+	return payouts, nil
+}
+
+// addPayouts adds the payouts newer than the wallet's last one to its
+// total; the first time, all listed payouts count. p.mu must be held.
+func (p *poolWorkers) addPayouts(w poolWallet, payouts []payout) {
+	wp, ok := p.payouts[w]
+	if !ok {
+		wp = &walletPayouts{}
+		p.payouts[w] = wp
+	}
+	last := wp.lastTime
+	for _, po := range payouts {
+		if ok && po.time <= last {
+			continue
+		}
+		wp.total += po.amount
+		if po.time > wp.lastTime {
+			wp.lastTime, wp.lastAmount = po.time, po.amount
+		}
+	}
+}
+
+func (p *poolWorkers) Describe(ch chan<- *prometheus.Desc) {
+	ch <- payoutLastTimeDesc
+	ch <- payoutLastAmountDesc
+	ch <- payoutsTotalDesc
+}
+
+func (p *poolWorkers) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for w, wp := range p.payouts {
+		if wp.lastTime > 0 {
+			ch <- prometheus.MustNewConstMetric(payoutLastTimeDesc,
+				prometheus.GaugeValue,
+				float64(wp.lastTime),
+				w.coin, w.wallet)
+			ch <- prometheus.MustNewConstMetric(payoutLastAmountDesc,
+				prometheus.GaugeValue,
+				wp.lastAmount,
+				w.coin, w.wallet)
+		}
+		ch <- prometheus.MustNewConstMetric(payoutsTotalDesc,
+			prometheus.CounterValue,
+			wp.total,
+			w.coin, w.wallet)
+	}
+}
+
+// poolDiscrepancyMetrics compares the hashrate the pool credits the rig's
+// worker on its primary coin with the rig's own, its 30m average where
+// there is one, as pools average over similar windows. The worker comes
+// from the first pool in the pool field or the configured stratum user.
+func (c *ClaymoreStatsCollector) poolDiscrepancyMetrics(addr string, conf *expConf, stats *claymore.Stats) []prometheus.Metric {
+	if conf.File == nil {
+		return nil
+	}
+	coin, _ := conf.coins(addr, stats)
+	if conf.File.Coins[coin].PoolAPI == nil {
+		return nil
+	}
+	pools := parsePools(stats.Pool)
+	if len(pools) == 0 {
+		return nil
+	}
+	wallet, worker := pools[0].Wallet, pools[0].Worker
+	if len(wallet) == 0 {
+		wallet, worker = splitUser(conf.rig(addr).StratumUser)
+	}
+	if len(wallet) == 0 {
+		return nil
+	}
+	// Asking registers the wallet for payouts even without a worker.
+	poolRate, ok := poolStats.hashrate(coin, wallet, worker)
+	if !ok {
+		return nil
+	}
+
+	rigRate, _ := strconv.ParseFloat(stats.TotalRate, 64)
+	rigRate *= 1000
+	c.mu.Lock()
+	if avg, ok := c.averages[addr]; ok {
+		rigRate = avg.total[len(avg.total)-1].value * 1000
+	}
+	c.mu.Unlock()
+
+	metrics := []prometheus.Metric{prometheus.MustNewConstMetric(poolHashrateDesc,
+		prometheus.GaugeValue,
+		poolRate,
+		addr)}
+	if rigRate > 0 {
+		metrics = append(metrics, prometheus.MustNewConstMetric(poolDiscrepancyDesc,
+			prometheus.GaugeValue,
+			(poolRate-rigRate)/rigRate,
+			addr))
+	}
+	return metrics
+}
@@ -0,0 +1,199 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var wallPowerDesc = prometheus.NewDesc(
+	"claymore_rig_wall_power_watts",
+	"Power drawn by the rig at the wall, read from its smart plug",
+	[]string{"Rig"},
+	nil)
+
+var rigEfficiencyDesc = prometheus.NewDesc(
+	"claymore_rig_efficiency_hashes_per_joule",
+	"Rig hashrate divided by the power it draws at the wall, read from its smart plug",
+	[]string{"Rig"},
+	nil)
+
+// plugConf is the smart plug a rig is powered through.
+type plugConf struct {
+	// Type is one of "tasmota", "shelly" or "kasa".
+	Type string `json:"type"`
+	// Addr is the plug's host, or host:port for a non-default port.
+	Addr string `json:"addr"`
+}
+
+// readPlugPower returns the power in watts the plug currently measures.
+func readPlugPower(p *plugConf) (float64, error) {
+	switch p.Type {
+	case "tasmota":
+		return tasmotaPower(p.Addr)
+	case "shelly":
+		return shellyPower(p.Addr)
+	case "kasa":
+		return kasaPower(p.Addr)
+	}
+	return 0, fmt.Errorf("unknown plug type %q", p.Type)
+}
+
+func getJSON(url string, v interface{}) error {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %v", url, err)
+	}
+	return nil
+}
+
+// tasmotaPower reads the energy sensor of a Tasmota plug (Status 8).
+func tasmotaPower(addr string) (float64, error) {
+	var status struct {
+		StatusSNS struct {
+			Energy *struct {
+				Power float64 `json:"Power"`
+			} `json:"ENERGY"`
+		} `json:"StatusSNS"`
+	}
+	if err := getJSON("http://"+addr+"/cm?cmnd=Status%208", &status); err != nil {
+		return 0, err
+	}
+	if status.StatusSNS.Energy == nil {
+		return 0, fmt.Errorf("plug has no energy sensor")
+	}
+	return status.StatusSNS.Energy.Power, nil
+}
+
+// shellyPower reads the first meter of a Shelly plug, from the Gen1
+// /status API or, for Gen2 (Plus) devices, Switch.GetStatus.
+func shellyPower(addr string) (float64, error) {
+	var gen1 struct {
+		Meters []struct {
+			Power float64 `json:"power"`
+		} `json:"meters"`
+	}
+	if err := getJSON("http://"+addr+"/status", &gen1); err == nil && len(gen1.Meters) != 0 {
+		return gen1.Meters[0].Power, nil
+	}
+
+	var gen2 struct {
+		APower *float64 `json:"apower"`
+	}
+	if err := getJSON("http://"+addr+"/rpc/Switch.GetStatus?id=0", &gen2); err != nil {
+		return 0, err
+	}
+	if gen2.APower == nil {
+		return 0, fmt.Errorf("plug has no power meter")
+	}
+	return *gen2.APower, nil
+}
+
+// kasaCrypt is the autokey XOR cipher of the TP-Link Kasa local protocol.
+func kasaCrypt(data []byte, decrypt bool) []byte {
+	out := make([]byte, len(data))
+	key := byte(171)
+	for i, b := range data {
+		out[i] = b ^ key
+		if decrypt {
+			key = b
+		} else {
+			key = out[i]
+		}
+	}
+	return out
+}
+
+// kasaPower asks a Kasa plug with energy monitoring (HS110, KP115) for its
+// realtime reading over the local TCP protocol on port 9999.
+func kasaPower(addr string) (float64, error) {
+	host, port := splitTarget(addr, "9999")
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req := kasaCrypt([]byte(`{"emeter":{"get_realtime":{}}}`), false)
+	msg := make([]byte, 4, 4+len(req))
+	binary.BigEndian.PutUint32(msg, uint32(len(req)))
+	if _, err := conn.Write(append(msg, req...)); err != nil {
+		return 0, err
+	}
+
+	var size uint32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return 0, fmt.Errorf("reading reply: %v", err)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, fmt.Errorf("reading reply: %v", err)
+	}
+
+	// Older firmware reports power in watts, newer in milliwatts.
+	var reply struct {
+		Emeter struct {
+			Realtime struct {
+				Power   *float64 `json:"power"`
+				PowerMW *float64 `json:"power_mw"`
+				ErrCode int      `json:"err_code"`
+			} `json:"get_realtime"`
+		} `json:"emeter"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(kasaCrypt(body, true))).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("decoding reply: %v", err)
+	}
+	rt := reply.Emeter.Realtime
+	switch {
+	case rt.ErrCode != 0:
+		return 0, fmt.Errorf("plug returned error %d", rt.ErrCode)
+	case rt.Power != nil:
+		return *rt.Power, nil
+	case rt.PowerMW != nil:
+		return *rt.PowerMW / 1000, nil
+	}
+	return 0, fmt.Errorf("plug has no power meter")
+}
+
+// powerMetrics reads the rig's smart plug, if it has one configured, and
+// divides hashrate, in H/s, by its power for the rig's efficiency. A rig
+// whose miner is down has no hashrate, 0, and no efficiency.
+func powerMetrics(addr string, conf *expConf, hashrate float64) []prometheus.Metric {
+	plug := conf.rig(addr).Plug
+	if plug == nil {
+		return nil
+	}
+	watts, err := readPlugPower(plug)
+	if err != nil {
+		log.Printf("Reading %s plug of %s: %v", plug.Type, addr, err)
+		return nil
+	}
+	metrics := []prometheus.Metric{prometheus.MustNewConstMetric(wallPowerDesc,
+		prometheus.GaugeValue,
+		watts,
+		addr)}
+	if hashrate > 0 && watts > 0 {
+		metrics = append(metrics, prometheus.MustNewConstMetric(rigEfficiencyDesc,
+			prometheus.GaugeValue,
+			hashrate/watts,
+			addr))
+	}
+	return metrics
+}
@@ -0,0 +1,180 @@
+package exporter
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	coinPriceDesc = prometheus.NewDesc(
+		"claymore_coin_price",
+		"Price of one coin in a fiat currency",
+		[]string{"coin", "currency"},
+		nil)
+
+	earningsCoinsDesc = prometheus.NewDesc(
+		"claymore_earnings_estimated_coins_per_day",
+		"Estimated daily earnings of the rig at its current hashrate, in coins",
+		[]string{"Rig", "coin"},
+		nil)
+
+	earningsFiatDesc = prometheus.NewDesc(
+		"claymore_earnings_estimated_per_day",
+		"Estimated daily earnings of the rig at its current hashrate, in a fiat currency",
+		[]string{"Rig", "coin", "currency"},
+		nil)
+)
+
+// coinConf describes a coin for earnings estimates.
+type coinConf struct {
+	// PriceID is the coin's id at the price source, e.g. "ethereum".
+	PriceID string `json:"price_id"`
+	// RewardPerMHDay is how many coins one MH/s earns per day, from the
+	// pool's or a profitability calculator's current figure.
+	RewardPerMHDay float64 `json:"reward_per_mh_day"`
+	// ShareDifficulty is the share difficulty in hashes of the pool the
+	// coin is mined at, for share luck.
+	ShareDifficulty float64 `json:"share_difficulty"`
+	// PoolAPI is the pool's worker stats endpoint, for comparing the
+	// hashrate the pool sees with the rigs'.
+	PoolAPI *poolAPIConf `json:"pool_api"`
+	// NodeURL is a JSON-RPC endpoint of the coin's chain, a node of your
+	// own or a public one, to read the balances of Wallets from.
+	NodeURL string   `json:"node_url"`
+	Wallets []string `json:"wallets"`
+}
+
+// priceSource fetches coin prices in a CoinGecko simple/price compatible
+// format: {"ethereum": {"usd": 1234.5, "eur": 1100.2}}.
+type priceSource struct {
+	url        string
+	currencies []string
+
+	mu     sync.Mutex
+	prices map[string]map[string]float64 // coin -> currency -> price
+}
+
+var prices = &priceSource{prices: make(map[string]map[string]float64)}
+
+func (p *priceSource) fetch(coins map[string]coinConf) error {
+	ids := make(map[string]string) // price id -> coin
+	var idList []string
+	for coin, cc := range coins {
+		if len(cc.PriceID) != 0 {
+			ids[cc.PriceID] = coin
+			idList = append(idList, cc.PriceID)
+		}
+	}
+	if len(idList) == 0 {
+		return nil
+	}
+
+	q := url.Values{}
+	q.Set("ids", strings.Join(idList, ","))
+	q.Set("vs_currencies", strings.Join(p.currencies, ","))
+	sep := "?"
+	if strings.Contains(p.url, "?") {
+		sep = "&"
+	}
+
+	var reply map[string]map[string]float64
+	if err := getJSON(p.url+sep+q.Encode(), &reply); err != nil {
+		return err
+	}
+
+	fetched := make(map[string]map[string]float64)
+	for id, byCurrency := range reply {
+		if coin, ok := ids[id]; ok {
+			fetched[coin] = byCurrency
+		}
+	}
+	if len(fetched) == 0 {
+		return fmt.Errorf("no prices for %s", strings.Join(idList, ", "))
+	}
+
+	p.mu.Lock()
+	p.prices = fetched
+	p.mu.Unlock()
+	return nil
+}
+
+// refresh re-fetches prices once per interval. Errors keep the previous
+// prices.
+func (p *priceSource) refresh(interval time.Duration) {
+	for {
+		conf := currentConf()
+		if conf.File != nil {
+			if err := p.fetch(conf.File.Coins); err != nil {
+				log.Print("Fetching coin prices:", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (p *priceSource) get(coin string) map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.prices[coin]
+}
+
+func (p *priceSource) Describe(ch chan<- *prometheus.Desc) {
+	ch <- coinPriceDesc
+}
+
+func (p *priceSource) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for coin, byCurrency := range p.prices {
+		for currency, price := range byCurrency {
+			ch <- prometheus.MustNewConstMetric(coinPriceDesc,
+				prometheus.GaugeValue,
+				price,
+				coin, currency)
+		}
+	}
+}
+
+// earningsMetrics estimates the rig's daily earnings for its primary and,
+// when dual mining, secondary coin. Claymore reports hashrates in kH/s.
+func earningsMetrics(addr string, conf *expConf, stats *claymore.Stats) []prometheus.Metric {
+	if conf.File == nil || len(conf.File.Coins) == 0 {
+		return nil
+	}
+	primary, secondary := conf.coins(addr, stats)
+
+	var metrics []prometheus.Metric
+	for _, c := range []struct {
+		coin string
+		rate string
+	}{{primary, stats.TotalRate}, {secondary, stats.SecondaryRate}} {
+		cc, ok := conf.File.Coins[c.coin]
+		if !ok || cc.RewardPerMHDay <= 0 {
+			continue
+		}
+		khs, err := strconv.ParseFloat(c.rate, 64)
+		if err != nil || khs <= 0 {
+			continue
+		}
+		coins := khs / 1000 * cc.RewardPerMHDay
+		metrics = append(metrics, prometheus.MustNewConstMetric(earningsCoinsDesc,
+			prometheus.GaugeValue,
+			coins,
+			addr, c.coin))
+		for currency, price := range prices.get(c.coin) {
+			metrics = append(metrics, prometheus.MustNewConstMetric(earningsFiatDesc,
+				prometheus.GaugeValue,
+				coins*price,
+				addr, c.coin, currency))
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	probeSuccessDesc = prometheus.NewDesc(
+		"claymore_probe_success",
+		"1 if the miner answered and its reply could be parsed",
+		[]string{"Rig"},
+		nil)
+
+	probeDurationDesc = prometheus.NewDesc(
+		"claymore_probe_duration_seconds",
+		"Time taken to query the miner and parse its reply",
+		[]string{"Rig"},
+		nil)
+
+	probePhaseDesc = prometheus.NewDesc(
+		"claymore_probe_phase_duration_seconds",
+		"Time taken by each phase of the probe: dial, rpc and parse",
+		[]string{"Rig", "phase"},
+		nil)
+)
+
+// probeTimings is how long each phase of a rig's scrape took. A slow dial
+// points at the network, a slow rpc at the miner. remote is the address
+// the miner was reached at.
+type probeTimings struct {
+	dial   time.Duration
+	rpc    time.Duration
+	parse  time.Duration
+	remote string
+}
+
+func probeMetrics(addr string, success bool, t *probeTimings) []prometheus.Metric {
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(probeSuccessDesc,
+			prometheus.GaugeValue,
+			boolValue(success),
+			addr),
+		prometheus.MustNewConstMetric(probeDurationDesc,
+			prometheus.GaugeValue,
+			(t.dial + t.rpc + t.parse).Seconds(),
+			addr),
+	}
+	for phase, d := range map[string]time.Duration{"dial": t.dial, "rpc": t.rpc, "parse": t.parse} {
+		metrics = append(metrics, prometheus.MustNewConstMetric(probePhaseDesc,
+			prometheus.GaugeValue,
+			d.Seconds(),
+			addr, phase))
+	}
+	return metrics
+}
+
+// probeCollector exposes a single rig, for Prometheus setups that scrape
+// /probe?target=<rig> once per rig instead of /metrics for all of them.
+type probeCollector struct {
+	collector *ClaymoreStatsCollector
+	conf      *expConf
+	target    string
+}
+
+func (p *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	p.collector.Describe(ch)
+}
+
+func (p *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range p.collector.rigMetrics(context.Background(), p.target, p.conf) {
+		ch <- m
+	}
+}
+
+// probeHandler serves /probe?target=<rig>. Only configured rigs can be
+// probed: anything else would have the exporter dial any address it is
+// given, with the miner password, and keep state for every one.
+func probeHandler(c *ClaymoreStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if len(target) == 0 {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		conf := currentConf()
+		if !knownRig(conf, target) {
+			http.Error(w, fmt.Sprintf("unknown target %q", target), http.StatusNotFound)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(&probeCollector{collector: c, conf: conf, target: target})
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdHandler serves /sd, the configured rigs in Prometheus http_sd format.
+// Each rig is its own group so the __meta labels can be relabelled onto it.
+func sdHandler(w http.ResponseWriter, r *http.Request) {
+	conf := currentConf()
+
+	groups := []sdTargetGroup{}
+	for _, addr := range conf.Dial_Addr {
+		host, port := splitTarget(addr, conf.Port)
+		groups = append(groups, sdTargetGroup{
+			Targets: []string{addr},
+			Labels: map[string]string{
+				"__meta_claymore_rig":   addr,
+				"__meta_claymore_host":  host,
+				"__meta_claymore_port":  port,
+				"__meta_claymore_proto": conf.protoFor(addr),
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/spf13/cobra"
+)
+
+type queryOpts struct {
+	target string
+	format string
+	strict bool
+}
+
+func newQueryCmd() *cobra.Command {
+	o := &queryOpts{}
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Scrape one rig once and print its stats",
+		Long: "Scrape one rig once and print its stats as a table or JSON. Miner " +
+			"settings come from the usual CLAYMORE_* environment, except for the target.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error { return query(o) },
+	}
+	cmd.Flags().StringVar(&o.target, "target", "", "Rig to query, host or host:port.")
+	cmd.Flags().StringVar(&o.format, "format", "table", "Output format, table or json.")
+	cmd.Flags().BoolVar(&o.strict, "parser.strict", false, "Reject replies with mismatched GPU lists or non-numeric values.")
+	cmd.MarkFlagRequired("target")
+	return cmd
+}
+
+func query(o *queryOpts) error {
+	conf, err := readConfFor(o.target)
+	if err != nil {
+		return err
+	}
+
+	reply, err := callClaymore(o.target, conf, &probeTimings{})
+	if err != nil {
+		return fmt.Errorf("calling %s: %v", o.target, err)
+	}
+	stats, err := claymore.ParseReply(reply, o.strict)
+	if err != nil {
+		return fmt.Errorf("parsing reply of %s: %v", o.target, err)
+	}
+	for i := range stats.GPUs {
+		stats.GPUs[i].Name = conf.gpuName(o.target, i, stats.GPUs[i].Bus)
+	}
+
+	switch o.format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "table":
+		printStats(os.Stdout, o.target, stats)
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", o.format)
+}
+
+func printStats(out io.Writer, target string, stats *claymore.Stats) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Rig:\t%s\n", target)
+	fmt.Fprintf(w, "Version:\t%s\n", stats.Version)
+	fmt.Fprintf(w, "Uptime:\t%s min\n", stats.Uptime)
+	fmt.Fprintf(w, "Hashrate:\t%s\n", stats.TotalRate)
+	fmt.Fprintf(w, "Shares:\t%s found, %s rejected\n", stats.EthFound, stats.EthReject)
+	fmt.Fprintf(w, "Pool:\t%s\n", stats.Pool)
+	w.Flush()
+	fmt.Fprintln(out)
+
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GPU\tHASHRATE\tTEMP\tFAN\tBUS\tENABLED")
+	for _, gpu := range stats.GPUs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\n", gpu.Name, gpu.HashRate, gpu.Temp, gpu.FanSpeed, gpu.Bus, gpu.Enabled)
+	}
+	w.Flush()
+}
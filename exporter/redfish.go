@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hostPowerDesc = prometheus.NewDesc(
+		"claymore_host_power_watts",
+		"Chassis power consumption reported by the rig host's BMC",
+		[]string{"Rig"},
+		nil)
+
+	hostInletTempDesc = prometheus.NewDesc(
+		"claymore_host_inlet_temp_celsius",
+		"Inlet temperature reported by the rig host's BMC",
+		[]string{"Rig"},
+		nil)
+
+	hostFanDesc = prometheus.NewDesc(
+		"claymore_host_fan_rpm",
+		"Chassis fan speed reported by the rig host's BMC",
+		[]string{"Rig", "fan"},
+		nil)
+)
+
+// redfishConf is the BMC of a server-grade rig host.
+type redfishConf struct {
+	// URL is the BMC's base URL, e.g. https://10.0.0.5.
+	URL  string `json:"url"`
+	User string `json:"user"`
+	// Password may also come from the Vault key redfish.<rig>.
+	Password string `json:"password"`
+	// Insecure skips verification of the BMC's certificate, which is
+	// usually self-signed.
+	Insecure bool `json:"insecure"`
+}
+
+var redfishInsecureClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+type redfishClient struct {
+	conf     *redfishConf
+	password string
+	http     *http.Client
+}
+
+func (c *redfishClient) get(path string, v interface{}) error {
+	url := strings.TrimSuffix(c.conf.URL, "/") + path
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.conf.User, c.password)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %v", url, err)
+	}
+	return nil
+}
+
+type redfishLink struct {
+	ID string `json:"@odata.id"`
+}
+
+type redfishPower struct {
+	PowerControl []struct {
+		PowerConsumedWatts *float64
+	}
+}
+
+type redfishThermal struct {
+	Temperatures []struct {
+		Name            string
+		PhysicalContext string
+		ReadingCelsius  *float64
+	}
+	Fans []struct {
+		Name         string
+		FanName      string
+		Reading      *float64
+		ReadingUnits string
+	}
+}
+
+// hostMetrics reads power, inlet temperature and fans of the first chassis
+// the BMC lists.
+func hostMetrics(addr string, conf *expConf) []prometheus.Metric {
+	rf := conf.rig(addr).Redfish
+	if rf == nil {
+		return nil
+	}
+	c := &redfishClient{conf: rf, password: rf.Password, http: httpClient}
+	if password, ok := secrets.get("redfish." + addr); ok {
+		c.password = password
+	}
+	if rf.Insecure {
+		c.http = redfishInsecureClient
+	}
+
+	var chassis struct {
+		Members []redfishLink
+	}
+	if err := c.get("/redfish/v1/Chassis", &chassis); err != nil {
+		log.Printf("Reading Redfish chassis of %s: %v", addr, err)
+		return nil
+	}
+	if len(chassis.Members) == 0 {
+		log.Printf("Redfish service of %s lists no chassis", addr)
+		return nil
+	}
+	base := chassis.Members[0].ID
+
+	var metrics []prometheus.Metric
+
+	var power redfishPower
+	if err := c.get(base+"/Power", &power); err != nil {
+		log.Printf("Reading Redfish power of %s: %v", addr, err)
+	} else if len(power.PowerControl) != 0 && power.PowerControl[0].PowerConsumedWatts != nil {
+		metrics = append(metrics, prometheus.MustNewConstMetric(hostPowerDesc,
+			prometheus.GaugeValue,
+			*power.PowerControl[0].PowerConsumedWatts,
+			addr))
+	}
+
+	var thermal redfishThermal
+	if err := c.get(base+"/Thermal", &thermal); err != nil {
+		log.Printf("Reading Redfish thermal of %s: %v", addr, err)
+		return metrics
+	}
+	for _, t := range thermal.Temperatures {
+		if t.ReadingCelsius == nil {
+			continue
+		}
+		if t.PhysicalContext == "Intake" || strings.Contains(strings.ToLower(t.Name), "inlet") {
+			metrics = append(metrics, prometheus.MustNewConstMetric(hostInletTempDesc,
+				prometheus.GaugeValue,
+				*t.ReadingCelsius,
+				addr))
+			break
+		}
+	}
+	for _, f := range thermal.Fans {
+		if f.Reading == nil || (len(f.ReadingUnits) != 0 && f.ReadingUnits != "RPM") {
+			continue
+		}
+		name := f.Name
+		if len(name) == 0 {
+			name = f.FanName
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(hostFanDesc,
+			prometheus.GaugeValue,
+			*f.Reading,
+			addr, name))
+	}
+	return metrics
+}
@@ -0,0 +1,233 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	resolveFailuresDesc = prometheus.NewDesc(
+		"claymore_target_resolve_failures_total",
+		"Failed DNS lookups of a hostname target's host",
+		[]string{"Rig"},
+		nil)
+
+	resolveSuccessDesc = prometheus.NewDesc(
+		"claymore_target_resolve_success",
+		"1 if the last DNS lookup of a hostname target's host succeeded",
+		[]string{"Rig"},
+		nil)
+)
+
+type resolvedHost struct {
+	addrs    []string
+	ok       bool
+	failures float64
+}
+
+// resolver caches the addresses of hostname targets and refreshes them in
+// the background, so rigs on DHCP with dynamic DNS keep being found after
+// their address changes. IP targets bypass it.
+type resolver struct {
+	mu    sync.Mutex
+	hosts map[string]*resolvedHost
+
+	// dns resolves with the --targets.dns-server or --targets.resolv-conf
+	// servers, the host resolver if nil.
+	dns *net.Resolver
+}
+
+// hosts is shared by everything that dials or compares targets.
+var hosts = &resolver{hosts: make(map[string]*resolvedHost)}
+
+// dnsTimeout bounds one lookup of a target.
+const dnsTimeout = 10 * time.Second
+
+func (r *resolver) resolve(host string) *resolvedHost {
+	dns := r.dns
+	if dns == nil {
+		dns = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	addrs, err := dns.LookupHost(ctx, host)
+	cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hosts[host]
+	if !ok {
+		h = &resolvedHost{}
+		r.hosts[host] = h
+	}
+	if err != nil {
+		log.Printf("Resolving %s: %v", host, err)
+		h.ok = false
+		h.failures++
+		// Keep the previous addresses, the rig may still be there.
+		return h
+	}
+	h.addrs = addrs
+	h.ok = true
+	return h
+}
+
+// newDNSResolver returns a resolver asking the DNS servers, host or
+// host:port, in order until one answers, for mining VLANs with their own
+// DNS.
+func newDNSResolver(servers []string) *net.Resolver {
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		addrs[i] = s
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			addrs[i] = net.JoinHostPort(s, "53")
+		}
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			var err error
+			for _, addr := range addrs {
+				var conn net.Conn
+				if conn, err = d.DialContext(ctx, network, addr); err == nil {
+					return conn, nil
+				}
+			}
+			return nil, err
+		},
+	}
+}
+
+// readResolvConf returns the nameservers of a resolv.conf file.
+func readResolvConf(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameserver in %s", path)
+	}
+	return servers, nil
+}
+
+// lookupAll returns the cached addresses of host, resolving it on first use.
+func (r *resolver) lookupAll(host string) []string {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}
+	}
+
+	r.mu.Lock()
+	h, ok := r.hosts[host]
+	r.mu.Unlock()
+	if !ok {
+		h = r.resolve(host)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return h.addrs
+}
+
+// lookup returns the address to dial for host, or host itself if it has
+// never resolved and the dialer should try on its own.
+func (r *resolver) lookup(host string) string {
+	addrs := r.lookupAll(host)
+	if len(addrs) == 0 {
+		return host
+	}
+	return addrs[0]
+}
+
+// refresh re-resolves the hostnames of the configured targets once per
+// interval and forgets those no target has any more.
+func (r *resolver) refresh(interval time.Duration) {
+	for range time.Tick(interval) {
+		conf := currentConf()
+		targets := make(map[string]bool, len(conf.Dial_Addr))
+		for _, addr := range conf.Dial_Addr {
+			host, _ := splitTarget(addr, conf.Port)
+			targets[host] = true
+		}
+
+		r.mu.Lock()
+		var names []string
+		for name := range r.hosts {
+			if !targets[name] {
+				delete(r.hosts, name)
+				continue
+			}
+			names = append(names, name)
+		}
+		r.mu.Unlock()
+
+		for _, name := range names {
+			r.resolve(name)
+		}
+	}
+}
+
+func (r *resolver) Describe(ch chan<- *prometheus.Desc) {
+	ch <- resolveFailuresDesc
+	ch <- resolveSuccessDesc
+}
+
+// Collect exports the lookups by target, so they join with the target's
+// other series; targets sharing a host share its lookups.
+func (r *resolver) Collect(ch chan<- prometheus.Metric) {
+	conf := currentConf()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, addr := range conf.Dial_Addr {
+		host, _ := splitTarget(addr, conf.Port)
+		h, ok := r.hosts[host]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(resolveFailuresDesc,
+			prometheus.CounterValue,
+			h.failures,
+			addr)
+		ch <- prometheus.MustNewConstMetric(resolveSuccessDesc,
+			prometheus.GaugeValue,
+			boolValue(h.ok),
+			addr)
+	}
+}
+
+// splitTarget splits a target into host and API port. Targets may carry
+// their own port ("192.168.1.1:3334") to address one of several miner
+// instances on a host; bare hosts use defaultPort.
+func splitTarget(addr, defaultPort string) (host, port string) {
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		return h, p
+	}
+	return addr, defaultPort
+}
+
+// dialAddr is the host:port to dial for a target.
+func dialAddr(addr, defaultPort string) string {
+	host, port := splitTarget(addr, defaultPort)
+	return net.JoinHostPort(hosts.lookup(host), port)
+}
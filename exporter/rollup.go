@@ -0,0 +1,201 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dailyAvailabilityDesc = prometheus.NewDesc(
+		"claymore_daily_availability_ratio",
+		"Share of the rig's history samples of the previous UTC day in which it was up",
+		[]string{"Rig"},
+		nil)
+
+	dailyHashrateDesc = prometheus.NewDesc(
+		"claymore_daily_hashrate_average_hashes_per_second",
+		"Average total hashrate of the rig over the previous UTC day, down time counting as zero",
+		[]string{"Rig"},
+		nil)
+
+	dailyEarningsCoinsDesc = prometheus.NewDesc(
+		"claymore_daily_earnings_estimated_coins",
+		"Estimated earnings of the rig's primary coin over the previous UTC day, in coins",
+		[]string{"Rig", "coin"},
+		nil)
+
+	dailyEarningsFiatDesc = prometheus.NewDesc(
+		"claymore_daily_earnings_estimated",
+		"Estimated earnings of the rig's primary coin over the previous UTC day, in a fiat currency at the current price",
+		[]string{"Rig", "coin", "currency"},
+		nil)
+)
+
+// dailyRollup sums up one rig's history of one UTC day.
+type dailyRollup struct {
+	Rig  string `json:"rig"`
+	Date string `json:"date"`
+	// Samples is how many history samples the day had; the other values
+	// are only as good as the history covering the day.
+	Samples             int     `json:"samples"`
+	AvailabilityPercent float64 `json:"availability_percent"`
+	// Hashrate is the day's average in H/s, down time counting as zero.
+	Hashrate      float64            `json:"hashrate"`
+	Coin          string             `json:"coin,omitempty"`
+	EarningsCoins float64            `json:"earnings_coins,omitempty"`
+	Earnings      map[string]float64 `json:"earnings,omitempty"`
+}
+
+// rollupDay sums up the rig's samples from day (midnight UTC) to the next
+// midnight. ok is false if there are none.
+func (c *ClaymoreStatsCollector) rollupDay(addr string, conf *expConf, day time.Time) (r dailyRollup, ok bool) {
+	end := day.AddDate(0, 0, 1)
+	r = dailyRollup{Rig: addr, Date: day.Format("2006-01-02")}
+	var up int
+	var rateSum float64
+	for _, s := range c.history.query(addr, day.Add(-time.Nanosecond)) {
+		if s.Time.Before(day) {
+			continue
+		}
+		if !s.Time.Before(end) {
+			break
+		}
+		r.Samples++
+		if !s.Down {
+			up++
+			rateSum += s.TotalRate
+		}
+	}
+	if r.Samples == 0 {
+		return r, false
+	}
+	r.AvailabilityPercent = 100 * float64(up) / float64(r.Samples)
+	khs := rateSum / float64(r.Samples)
+	r.Hashrate = khs * 1000
+
+	// The coin comes from the miner version, history only has the primary
+	// hashrate.
+	c.mu.Lock()
+	var version string
+	if inv, ok := c.inventory[addr]; ok {
+		version = inv.Version
+	}
+	c.mu.Unlock()
+	coin, _ := conf.coins(addr, &claymore.Stats{Version: version})
+	if conf.File != nil {
+		if cc, ok := conf.File.Coins[coin]; ok && cc.RewardPerMHDay > 0 {
+			r.Coin = coin
+			r.EarningsCoins = khs / 1000 * cc.RewardPerMHDay
+			for currency, price := range prices.get(coin) {
+				if r.Earnings == nil {
+					r.Earnings = make(map[string]float64)
+				}
+				r.Earnings[currency] = r.EarningsCoins * price
+			}
+		}
+	}
+	return r, true
+}
+
+// rollups returns the rollups of the configured rigs with history on day.
+func (c *ClaymoreStatsCollector) rollups(conf *expConf, day time.Time) []dailyRollup {
+	out := []dailyRollup{}
+	if c.history == nil {
+		return out
+	}
+	for _, addr := range conf.Dial_Addr {
+		if r, ok := c.rollupDay(addr, conf, day); ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// utcDay returns midnight UTC of the day t is in.
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// dailyRollups exports the previous day's rollups. They only change at
+// midnight, so they are computed once per day, on the first scrape after it.
+type dailyRollups struct {
+	c *ClaymoreStatsCollector
+
+	mu      sync.Mutex
+	day     time.Time
+	rollups []dailyRollup
+}
+
+func (d *dailyRollups) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dailyAvailabilityDesc
+	ch <- dailyHashrateDesc
+	ch <- dailyEarningsCoinsDesc
+	ch <- dailyEarningsFiatDesc
+}
+
+func (d *dailyRollups) Collect(ch chan<- prometheus.Metric) {
+	yesterday := utcDay(time.Now()).AddDate(0, 0, -1)
+	d.mu.Lock()
+	if !d.day.Equal(yesterday) {
+		d.day = yesterday
+		d.rollups = d.c.rollups(currentConf(), yesterday)
+	}
+	rollups := d.rollups
+	d.mu.Unlock()
+
+	for _, r := range rollups {
+		ch <- prometheus.MustNewConstMetric(dailyAvailabilityDesc,
+			prometheus.GaugeValue,
+			r.AvailabilityPercent/100,
+			r.Rig)
+		ch <- prometheus.MustNewConstMetric(dailyHashrateDesc,
+			prometheus.GaugeValue,
+			r.Hashrate,
+			r.Rig)
+		if len(r.Coin) == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(dailyEarningsCoinsDesc,
+			prometheus.GaugeValue,
+			r.EarningsCoins,
+			r.Rig, r.Coin)
+		for currency, v := range r.Earnings {
+			ch <- prometheus.MustNewConstMetric(dailyEarningsFiatDesc,
+				prometheus.GaugeValue,
+				v,
+				r.Rig, r.Coin, currency)
+		}
+	}
+}
+
+// rollupsHandler serves /api/v1/rollups?date=2006-01-02, the previous UTC
+// day by default.
+func rollupsHandler(c *ClaymoreStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.history == nil {
+			http.Error(w, "history is disabled", http.StatusNotFound)
+			return
+		}
+		day := utcDay(time.Now()).AddDate(0, 0, -1)
+		if date := r.URL.Query().Get("date"); len(date) != 0 {
+			t, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				http.Error(w, "bad date: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			day = t
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"date":    day.Format("2006-01-02"),
+			"rollups": c.rollups(currentConf(), day),
+		})
+	}
+}
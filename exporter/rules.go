@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"io"
+	"text/template"
+)
+
+// rulesConf parameterizes the generated alerting rules.
+type rulesConf struct {
+	TempThreshold float64
+	RejectRatio   float64
+	HashrateDrop  float64
+}
+
+var rulesTemplate = template.Must(template.New("rules").Parse(`groups:
+- name: claymore
+  rules:
+  - alert: ClaymoreRigDown
+    expr: claymore_up == 0 unless on(Rig) claymore_rig_maintenance == 1
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: "Rig {{"{{"}} $labels.Rig {{"}}"}} is down"
+      description: "The miner on {{"{{"}} $labels.Rig {{"}}"}} is unreachable or its replies can't be used."
+
+  - alert: ClaymoreGPUOverTemp
+    expr: claymore_gpu_temperature_celsius > {{.TempThreshold}} unless on(Rig) claymore_rig_maintenance == 1
+    for: 5m
+    labels:
+      severity: warning
+    annotations:
+      summary: "{{"{{"}} $labels.GPU {{"}}"}} on {{"{{"}} $labels.Rig {{"}}"}} is above {{.TempThreshold}}C"
+      description: "GPU temperature is {{"{{"}} $value {{"}}"}}C."
+
+  - alert: ClaymoreRejectRatioHigh
+    expr: rate(claymore_shares_rejected_total[30m]) / rate(claymore_shares_found_total[30m]) > {{.RejectRatio}} unless on(Rig) claymore_rig_maintenance == 1
+    for: 15m
+    labels:
+      severity: warning
+    annotations:
+      summary: "Rig {{"{{"}} $labels.Rig {{"}}"}} rejects too many {{"{{"}} $labels.coin {{"}}"}} shares"
+      description: "Rejected to found share ratio is {{"{{"}} $value {{"}}"}}."
+
+  - alert: ClaymoreHashrateDrop
+    expr: claymore_hashrate_hashes_per_second < (1 - {{.HashrateDrop}}) * avg_over_time(claymore_hashrate_hashes_per_second[6h]) and claymore_hashrate_hashes_per_second > 0 unless on(Rig) claymore_rig_maintenance == 1
+    for: 15m
+    labels:
+      severity: warning
+    annotations:
+      summary: "Rig {{"{{"}} $labels.Rig {{"}}"}} hashrate dropped"
+      description: "Hashrate is {{"{{"}} $value {{"}}"}} H/s, more than {{.HashrateDrop}} below its 6h average."
+`))
+
+// writeRules writes a Prometheus alerting rules file.
+func writeRules(w io.Writer, rc rulesConf) error {
+	return rulesTemplate.Execute(w, rc)
+}
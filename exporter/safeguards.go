@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// confirmTTL is how long a confirmation token stays valid.
+const confirmTTL = time.Minute
+
+// pendingConfirm is a destructive command waiting for its second request.
+type pendingConfirm struct {
+	who, rig, method string
+	expires          time.Time
+}
+
+// controlGuard keeps an automation bug from hammering the farm: it limits
+// how many commands each rig gets per window and can require destructive
+// commands to be confirmed with a second request.
+type controlGuard struct {
+	// limit is the number of commands a rig accepts per window, 0 for no
+	// limit.
+	limit  int
+	window time.Duration
+	// confirm lists the methods that need confirming.
+	confirm map[string]bool
+
+	mu      sync.Mutex
+	sent    map[string][]time.Time
+	pending map[string]pendingConfirm
+}
+
+var guard = &controlGuard{
+	sent:    make(map[string][]time.Time),
+	pending: make(map[string]pendingConfirm),
+}
+
+// allow records a command to rig if it is within the limit. Otherwise it
+// returns how long until the next one is allowed.
+func (g *controlGuard) allow(rig string, now time.Time) (bool, time.Duration) {
+	if g.limit <= 0 {
+		return true, 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	recent := g.sent[rig][:0]
+	for _, t := range g.sent[rig] {
+		if now.Sub(t) < g.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= g.limit {
+		g.sent[rig] = recent
+		return false, recent[0].Add(g.window).Sub(now)
+	}
+	g.sent[rig] = append(recent, now)
+	return true, 0
+}
+
+// needsConfirm tells whether method has to be confirmed.
+func (g *controlGuard) needsConfirm(method string) bool {
+	return g.confirm[method]
+}
+
+// newConfirm issues a token that lets who send method to rig once, within
+// confirmTTL.
+func (g *controlGuard) newConfirm(who, rig, method string, now time.Time) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for t, p := range g.pending {
+		if now.After(p.expires) {
+			delete(g.pending, t)
+		}
+	}
+	g.pending[token] = pendingConfirm{who: who, rig: rig, method: method, expires: now.Add(confirmTTL)}
+	return token
+}
+
+// useConfirm consumes token if it was issued for this command.
+func (g *controlGuard) useConfirm(token, who, rig, method string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.pending[token]
+	if !ok || now.After(p.expires) || p.who != who || p.rig != rig || p.method != method {
+		return false
+	}
+	delete(g.pending, token)
+	return true
+}
@@ -0,0 +1,105 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/murat1985/claymore_exporter/claymore"
+)
+
+// replyLimit is --scrape.max-reply-bytes, the most read from a miner for
+// one reply.
+var replyLimit int64 = 1 << 20
+
+// errReplyLimit is returned for a miner sending more than replyLimit.
+var errReplyLimit = errors.New("reply size limit exceeded")
+
+// limitedConn fails reads once replyLimit bytes have been read, so a
+// broken or hostile miner can't make the exporter buffer without bound.
+type limitedConn struct {
+	net.Conn
+	left int64
+}
+
+func limitConn(conn net.Conn) net.Conn {
+	return &limitedConn{Conn: conn, left: replyLimit}
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if c.left <= 0 {
+		return 0, errReplyLimit
+	}
+	if int64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.Conn.Read(p)
+	c.left -= int64(n)
+	return n, err
+}
+
+// readLimited reads r to the end, failing past replyLimit bytes.
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, replyLimit+1))
+	if err == nil && int64(len(data)) > replyLimit {
+		err = errReplyLimit
+	}
+	return data, err
+}
+
+// Value ranges a reading must be in to be believed. maxGPUHashrate is
+// --sanity.max-gpu-hashrate, in H/s.
+const (
+	minTemp, maxTemp = 0, 150
+	minFan, maxFan   = 0, 100
+)
+
+var maxGPUHashrate = 1e10
+
+// checkValues drops or clamps the readings of a reply that can't be true,
+// so a buggy or compromised rig doesn't poison dashboards and alerts, and
+// counts them in claymore_invalid_values_total. Temperatures and GPU
+// hashrates out of range are dropped, which leaves their series out; fan
+// speeds are clamped. NaN readings are dropped, fans included. A total
+// hashrate out of range or NaN is replaced by the sum of the GPUs'
+// remaining ones.
+func (c *ClaymoreStatsCollector) checkValues(addr string, stats *claymore.Stats) {
+	invalid := func(field string) {
+		c.invalidValues.WithLabelValues(addr, field).Inc()
+	}
+	var sum float64
+	for i := range stats.GPUs {
+		gpu := &stats.GPUs[i]
+		if temp, err := strconv.ParseFloat(gpu.Temp, 64); err == nil && (math.IsNaN(temp) || temp < minTemp || temp > maxTemp) {
+			gpu.Temp = ""
+			invalid("temp")
+		}
+		if fan, err := strconv.ParseFloat(gpu.FanSpeed, 64); err == nil && math.IsNaN(fan) {
+			gpu.FanSpeed = ""
+			invalid("fan")
+		} else if err == nil && (fan < minFan || fan > maxFan) {
+			gpu.FanSpeed = strconv.Itoa(maxFan)
+			if fan < minFan {
+				gpu.FanSpeed = strconv.Itoa(minFan)
+			}
+			invalid("fan")
+		}
+		// Claymore reports kH/s.
+		rate, err := strconv.ParseFloat(gpu.HashRate, 64)
+		if err == nil && (math.IsNaN(rate) || rate < 0 || rate*1000 > maxGPUHashrate) {
+			gpu.HashRate = ""
+			invalid("hashrate")
+			continue
+		}
+		sum += rate
+	}
+
+	maxTotal := maxGPUHashrate * float64(len(stats.GPUs))
+	if total, err := strconv.ParseFloat(stats.TotalRate, 64); err == nil && (math.IsNaN(total) || total < 0 || total*1000 > maxTotal) {
+		stats.TotalRate = fmt.Sprint(sum)
+		invalid("total_hashrate")
+	}
+}
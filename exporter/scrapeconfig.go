@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// scrapeConf parameterizes the generated Prometheus scrape config.
+type scrapeConf struct {
+	// Exporter is the host:port Prometheus reaches the exporter on.
+	Exporter    string
+	MetricsPath string
+	Rigs        []string
+}
+
+var scrapeTemplates = map[string]*template.Template{
+	// static scrapes every rig through /metrics.
+	"static": template.Must(template.New("static").Parse(`scrape_configs:
+  - job_name: claymore
+    metrics_path: {{.MetricsPath}}
+    static_configs:
+      - targets: ['{{.Exporter}}']
+`)),
+
+	// probe scrapes each rig through /probe, so each rig is its own target
+	// with its own up metric.
+	"probe": template.Must(template.New("probe").Parse(`scrape_configs:
+  - job_name: claymore
+    metrics_path: /probe
+    static_configs:
+      - targets:
+{{- range .Rigs}}
+          - '{{.}}'
+{{- end}}
+    relabel_configs:
+      - source_labels: [__address__]
+        target_label: __param_target
+      - source_labels: [__param_target]
+        target_label: instance
+      - target_label: __address__
+        replacement: '{{.Exporter}}'
+`)),
+}
+
+// firstTCPAddr returns the first of the listen addresses that isn't a unix
+// socket, the one Prometheus can scrape.
+func firstTCPAddr(addrs []string) string {
+	for _, addr := range addrs {
+		if len(addr) != 0 && !strings.HasPrefix(addr, "unix:") {
+			return addr
+		}
+	}
+	return ":10333"
+}
+
+// exporterAddr turns the listen address into one Prometheus can reach,
+// filling in this host's name for wildcard listeners.
+func exporterAddr(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if len(host) == 0 || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+		if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// writeScrapeConfig writes a scrape_configs block in the given style,
+// static or probe.
+func writeScrapeConfig(w io.Writer, style string, sc scrapeConf) error {
+	t, ok := scrapeTemplates[style]
+	if !ok {
+		return fmt.Errorf("unknown scrape config style %q, want static or probe", style)
+	}
+	return t.Execute(w, sc)
+}
@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scriptStats is the stats document a script miner's command may print
+// instead of a Claymore reply. Hashrates are in H/s.
+type scriptStats struct {
+	Version       string      `json:"version"`
+	UptimeMinutes float64     `json:"uptime_minutes"`
+	Hashrate      float64     `json:"hashrate"`
+	Accepted      float64     `json:"accepted"`
+	Rejected      float64     `json:"rejected"`
+	Pool          string      `json:"pool"`
+	GPUs          []scriptGPU `json:"gpus"`
+}
+
+type scriptGPU struct {
+	Hashrate float64 `json:"hashrate"`
+	Temp     float64 `json:"temp"`
+	Fan      float64 `json:"fan"`
+	Accepted float64 `json:"accepted"`
+	Rejected float64 `json:"rejected"`
+	Bus      string  `json:"bus"`
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled"`
+}
+
+// claymoreReply renders the stats as the miner_getstat2 result the parser
+// reads.
+func (s *scriptStats) claymoreReply() *json.RawMessage {
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	var rates, secondary, tempFans, accepted, rejected, buses []string
+	for _, g := range s.GPUs {
+		if g.Enabled != nil && !*g.Enabled {
+			rates = append(rates, "off")
+		} else {
+			rates = append(rates, num(g.Hashrate/1000))
+		}
+		secondary = append(secondary, "off")
+		tempFans = append(tempFans, num(g.Temp), num(g.Fan))
+		accepted = append(accepted, num(g.Accepted))
+		rejected = append(rejected, num(g.Rejected))
+		buses = append(buses, g.Bus)
+	}
+	result := []string{
+		s.Version,
+		num(s.UptimeMinutes),
+		num(s.Hashrate/1000) + ";" + num(s.Accepted) + ";" + num(s.Rejected),
+		strings.Join(rates, ";"),
+		"0;0;0",
+		strings.Join(secondary, ";"),
+		strings.Join(tempFans, ";"),
+		s.Pool,
+		"0;0;0;0",
+		strings.Join(accepted, ";"),
+		strings.Join(rejected, ";"),
+		"", "", "", "",
+		strings.Join(buses, ";"),
+	}
+	raw, _ := json.Marshal(result)
+	reply := json.RawMessage(raw)
+	return &reply
+}
+
+// callScript runs the rig's command, for miners the exporter doesn't
+// speak to. It prints either a Claymore reply, as {"result": [...]} or the
+// bare array, or a scriptStats document. {rig} in the arguments, and
+// CLAYMORE_RIG in the environment, are the rig's target. The command gets
+// the dial and rpc timeouts together, its run time counts as rpc.
+func callScript(addr string, conf *expConf, t *probeTimings) (*json.RawMessage, error) {
+	command := conf.rig(addr).Command
+	if len(command) == 0 {
+		return nil, fmt.Errorf("proto exec needs a command")
+	}
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = strings.Replace(arg, "{rig}", addr, -1)
+	}
+
+	timeouts := conf.timeouts(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), timeouts.dial+timeouts.rpc)
+	defer cancel()
+	start := time.Now()
+	out, err := runCommand(ctx, args, "CLAYMORE_RIG="+addr)
+	t.rpc = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+
+	out = bytes.TrimSpace(out)
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(out, &doc) == nil {
+		if _, ok := doc["result"]; !ok {
+			var stats scriptStats
+			if err := json.Unmarshal(out, &stats); err != nil {
+				return nil, fmt.Errorf("decoding stats: %v", err)
+			}
+			return stats.claymoreReply(), nil
+		}
+	}
+	return decodeRawReply(out)
+}
@@ -0,0 +1,47 @@
+package exporter
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// shardConf splits the farm between exporters: each keeps the rigs whose
+// name hashes to its index, so every rig lands on exactly one of them
+// however the targets are listed. Adding a shard moves about 1/total of
+// the rigs.
+type shardConf struct {
+	index, total int
+}
+
+var shard shardConf
+
+func (s shardConf) check() error {
+	if s.total < 1 || s.index < 0 || s.index >= s.total {
+		return fmt.Errorf("--shard.index must be between 0 and --shard.total-1, got %d of %d", s.index, s.total)
+	}
+	return nil
+}
+
+// owns reports whether the rig belongs to this exporter's shard.
+func (s shardConf) owns(rig string) bool {
+	if s.total <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(rig))
+	return int(h.Sum32()%uint32(s.total)) == s.index
+}
+
+// filter returns the rigs of this exporter's shard.
+func (s shardConf) filter(rigs []string) []string {
+	if s.total <= 1 {
+		return rigs
+	}
+	var out []string
+	for _, rig := range rigs {
+		if s.owns(rig) {
+			out = append(out, rig)
+		}
+	}
+	return out
+}
@@ -0,0 +1,252 @@
+package exporter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var silencedDesc = prometheus.NewDesc(
+	"claymore_alerts_silenced_total",
+	"Alerts and webhook changes of the rig held back by a silence or maintenance",
+	[]string{"Rig", "alert"},
+	nil)
+
+// silence mutes the built-in alerts, those published to the event bus and
+// the webhook changes, like an Alertmanager silence: Rig and Alert match
+// the rig and the alert or change name, with * globs, empty matching any,
+// from StartsAt to EndsAt.
+type silence struct {
+	ID        string    `json:"id"`
+	Rig       string    `json:"rig"`
+	Alert     string    `json:"alert"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by"`
+}
+
+func (s *silence) matches(rig, alert string, now time.Time) bool {
+	if now.Before(s.StartsAt) || !now.Before(s.EndsAt) {
+		return false
+	}
+	match := func(pattern, v string) bool {
+		ok, _ := path.Match(pattern, v)
+		return len(pattern) == 0 || ok
+	}
+	return match(s.Rig, rig) && match(s.Alert, alert)
+}
+
+// silenceStore keeps the silences in memory, expired ones for a day.
+type silenceStore struct {
+	mu       sync.Mutex
+	silences map[string]*silence
+	silenced map[[2]string]float64
+}
+
+var silences = &silenceStore{
+	silences: make(map[string]*silence),
+	silenced: make(map[[2]string]float64),
+}
+
+// silencedRetention is how long expired silences stay listed.
+const silencedRetention = 24 * time.Hour
+
+func (s *silenceStore) add(sil *silence) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	sil.ID = hex.EncodeToString(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silences[sil.ID] = sil
+}
+
+// expire ends the silence now, returning false if there is none by id.
+func (s *silenceStore) expire(id string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sil, ok := s.silences[id]
+	if !ok {
+		return false
+	}
+	if now.Before(sil.EndsAt) {
+		sil.EndsAt = now
+	}
+	return true
+}
+
+// list returns the silences by start, dropping those expired for longer
+// than silencedRetention.
+func (s *silenceStore) list(now time.Time) []silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []silence{}
+	for id, sil := range s.silences {
+		if now.Sub(sil.EndsAt) > silencedRetention {
+			delete(s.silences, id)
+			continue
+		}
+		out = append(out, *sil)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartsAt.Before(out[j].StartsAt) })
+	return out
+}
+
+func (s *silenceStore) active(rig, alert string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sil := range s.silences {
+		if sil.matches(rig, alert, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressed reports whether an alert or webhook change of the rig is held
+// back, because the rig is in maintenance or a silence matches it.
+func suppressed(rig, alert string) bool {
+	if !inMaintenance(rig) && !silences.active(rig, alert, time.Now()) {
+		return false
+	}
+	silences.mu.Lock()
+	silences.silenced[[2]string{rig, alert}]++
+	silences.mu.Unlock()
+	return true
+}
+
+func (s *silenceStore) Describe(ch chan<- *prometheus.Desc) {
+	ch <- silencedDesc
+}
+
+func (s *silenceStore) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, n := range s.silenced {
+		ch <- prometheus.MustNewConstMetric(silencedDesc,
+			prometheus.CounterValue,
+			n,
+			k[0], k[1])
+	}
+}
+
+// silencesHandler serves /api/v1/silences: GET lists them, POST with
+// {"rig", "alert", "starts_at", "ends_at" or "duration", "comment"}
+// creates one and DELETE /api/v1/silences/{id} expires one. Changes need
+// the control scope.
+func silencesHandler(w http.ResponseWriter, r *http.Request) {
+	conf := currentConf()
+	now := time.Now()
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"silences": silences.list(now)})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/silences/")
+		who, denied := requireScope(w, r, conf, scopeControl)
+		if len(denied) != 0 {
+			audit(r, auditEvent{Who: who, Action: "expire_silence", Params: []string{id}, Result: denied})
+			return
+		}
+		if !silences.expire(id, now) {
+			http.NotFound(w, r)
+			return
+		}
+		audit(r, auditEvent{Who: who, Action: "expire_silence", Params: []string{id}, Result: auditOK})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req struct {
+		silence
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sil := req.silence
+	if sil.StartsAt.IsZero() {
+		sil.StartsAt = now
+	}
+	if len(req.Duration) != 0 {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("bad duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+		sil.EndsAt = sil.StartsAt.Add(d)
+	}
+	if !sil.EndsAt.After(sil.StartsAt) || !sil.EndsAt.After(now) {
+		http.Error(w, "ends_at or duration must end the silence after it starts and in the future", http.StatusBadRequest)
+		return
+	}
+	for _, p := range []string{sil.Rig, sil.Alert} {
+		if _, err := path.Match(p, ""); err != nil {
+			http.Error(w, fmt.Sprintf("bad pattern %q", p), http.StatusBadRequest)
+			return
+		}
+	}
+
+	who, denied := requireScope(w, r, conf, scopeControl)
+	params := []string{"rig=" + sil.Rig, "alert=" + sil.Alert, "ends_at=" + sil.EndsAt.Format(time.RFC3339)}
+	if len(denied) != 0 {
+		audit(r, auditEvent{Who: who, Action: "create_silence", Params: params, Result: denied})
+		return
+	}
+	sil.CreatedBy = who
+	silences.add(&sil)
+	audit(r, auditEvent{Who: who, Action: "create_silence", Params: append(params, "id="+sil.ID), Result: auditOK})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sil)
+}
+
+// silencesHTML lists the active and pending silences for the status page.
+func silencesHTML(now time.Time) string {
+	var b strings.Builder
+	b.WriteString("<h2>Silences</h2>\n")
+	n := 0
+	for _, sil := range silences.list(now) {
+		if !now.Before(sil.EndsAt) {
+			continue
+		}
+		if n == 0 {
+			b.WriteString("<table><tr><th>Rig</th><th>Alert</th><th>Starts</th><th>Ends</th><th>Comment</th><th>By</th></tr>\n")
+		}
+		n++
+		any := func(s string) string {
+			if len(s) == 0 {
+				return "any"
+			}
+			return html.EscapeString(s)
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			any(sil.Rig), any(sil.Alert),
+			sil.StartsAt.Format(time.RFC3339), sil.EndsAt.Format(time.RFC3339),
+			html.EscapeString(sil.Comment), html.EscapeString(sil.CreatedBy))
+	}
+	if n == 0 {
+		b.WriteString("<p>No active silences.</p>\n")
+	} else {
+		b.WriteString("</table>\n")
+	}
+	return b.String()
+}
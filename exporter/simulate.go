@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// simulator answers miner_getstat1 and miner_getstat2 like a Claymore rig
+// with a number of GPUs, for trying out the exporter, dashboards and alerts
+// without mining hardware. Like the miner, it answers miner_getfile and
+// ignores management commands, unless its API is read-only, which drops
+// everything but the stats.
+type simulator struct {
+	gpus     int
+	start    time.Time
+	readOnly bool
+}
+
+// simulatedConfig is the config.txt miner_getfile returns.
+const simulatedConfig = "-epool eth-eu1.nanopool.org:9999\n-mode 1\n"
+
+func (s *simulator) reply(method string) []string {
+	minutes := int(time.Since(s.start).Minutes())
+	shares := minutes * s.gpus / 2
+
+	var rates, tempFan, accepted, rejected, buses []string
+	total := 0
+	for i := 0; i < s.gpus; i++ {
+		rate := 30000 + rand.Intn(1000)
+		total += rate
+		rates = append(rates, strconv.Itoa(rate))
+		tempFan = append(tempFan, strconv.Itoa(60+rand.Intn(10)), strconv.Itoa(50+rand.Intn(20)))
+		accepted = append(accepted, strconv.Itoa(shares/s.gpus))
+		rejected = append(rejected, "0")
+		buses = append(buses, strconv.Itoa(i+1))
+	}
+
+	result := []string{
+		"9.3 - ETH",
+		strconv.Itoa(minutes),
+		fmt.Sprintf("%d;%d;0", total, shares),
+		strings.Join(rates, ";"),
+		"0;0;0",
+		strings.Repeat("off;", s.gpus-1) + "off",
+		strings.Join(tempFan, ";"),
+		"eth-eu1.nanopool.org:9999",
+		"0;0;0;0",
+	}
+	if method == "miner_getstat2" {
+		result = append(result,
+			strings.Join(accepted, ";"),
+			strings.Join(rejected, ";"),
+			strings.Join(rejected, ";"),
+			strings.Join(rejected, ";"),
+			strings.Join(rejected, ";"),
+			strings.Join(rejected, ";"),
+			strings.Join(buses, ";"))
+	}
+	return result
+}
+
+func (s *simulator) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var req struct {
+		ID     interface{} `json:"id"`
+		Method string      `json:"method"`
+		Params []string    `json:"params"`
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return
+	}
+	if err := json.Unmarshal(line, &req); err != nil {
+		log.Printf("Bad request from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if req.ID == nil {
+		req.ID = 0
+	}
+
+	var result []string
+	switch {
+	case strings.HasPrefix(req.Method, "miner_getstat"):
+		result = s.reply(req.Method)
+	case s.readOnly:
+		return
+	case req.Method == methodGetFile && len(req.Params) != 0:
+		result = []string{req.Params[0], hex.EncodeToString([]byte(simulatedConfig))}
+	default:
+		return
+	}
+	json.NewEncoder(conn).Encode(map[string]interface{}{
+		"id":     req.ID,
+		"result": result,
+		"error":  nil,
+	})
+}
+
+func (s *simulator) serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Simulating a %d GPU rig on %s", s.gpus, lis.Addr())
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func newSimulateCmd() *cobra.Command {
+	var (
+		listen   string
+		gpus     int
+		readOnly bool
+	)
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Serve a simulated Claymore API for testing",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if gpus < 1 {
+				return fmt.Errorf("--gpus must be at least 1")
+			}
+			s := &simulator{gpus: gpus, start: time.Now(), readOnly: readOnly}
+			return s.serve(listen)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":3333", "Address to serve the simulated miner API on.")
+	cmd.Flags().IntVar(&gpus, "gpus", 6, "Number of GPUs of the simulated rig.")
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Simulate a read-only API (negative -mport).")
+	return cmd
+}
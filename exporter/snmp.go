@@ -0,0 +1,477 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The exporter's SNMP agent answers SNMPv1 and v2c Get, GetNext and
+// GetBulk requests for the objects of mibs/CLAYMORE-EXPORTER-MIB.txt, read
+// from the latest sample of every rig. Only what facility monitoring needs
+// is implemented: no SNMPv3, no Set, no traps.
+
+// defaultSNMPBase is the MIB's root, under enterprise 32473, which IANA
+// reserves for documentation (RFC 5612). Operators with a private
+// enterprise number of their own can move it with --snmp.base-oid.
+const defaultSNMPBase = "1.3.6.1.4.1.32473.1"
+
+// BER tags of the SNMP types used here.
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berCounter32   = 0x41
+	berGauge32     = 0x42
+
+	// SNMPv2 exceptions in place of a varbind's value.
+	berNoSuchObject = 0x80
+	berEndOfMibView = 0x82
+
+	pduGetRequest   = 0xa0
+	pduGetNext      = 0xa1
+	pduResponse     = 0xa2
+	pduSetRequest   = 0xa3
+	pduGetBulk      = 0xa5
+	snmpVersion1    = 0
+	snmpVersion2c   = 1
+	snmpNoSuchName  = 2
+	snmpReadOnly    = 4
+	snmpNotWritable = 17
+)
+
+// snmpVar is one object of the agent's MIB view, its value already BER
+// encoded.
+type snmpVar struct {
+	oid   []uint32
+	value []byte
+}
+
+// parseOID parses a dotted OID like 1.3.6.1.
+func parseOID(s string) ([]uint32, error) {
+	var oid []uint32
+	for _, part := range strings.Split(strings.Trim(s, "."), ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad OID %q", s)
+		}
+		oid = append(oid, uint32(n))
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("bad OID %q", s)
+	}
+	return oid, nil
+}
+
+func compareOID(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+func oidAppend(base []uint32, sub ...uint32) []uint32 {
+	oid := make([]uint32, 0, len(base)+len(sub))
+	return append(append(oid, base...), sub...)
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	return append(append([]byte{tag}, berLength(len(body))...), body...)
+}
+
+func berInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return berTLV(berInteger, b)
+}
+
+// berUint encodes the unsigned types, Counter32 and Gauge32.
+func berUint(tag byte, v uint32) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return berTLV(tag, b)
+}
+
+// berGauge encodes a non-negative reading as Gauge32, clamped to its range.
+func berGauge(tag byte, v float64) []byte {
+	switch {
+	case v < 0:
+		v = 0
+	case v > 4294967295:
+		v = 4294967295
+	}
+	return berUint(tag, uint32(v))
+}
+
+// berOIDValue encodes oid, whose first two arcs share a subidentifier.
+func berOIDValue(oid []uint32) []byte {
+	var b []byte
+	for _, n := range append([]uint32{oid[0]*40 + oid[1]}, oid[2:]...) {
+		var sub []byte
+		sub = append(sub, byte(n&0x7f))
+		for n >>= 7; n > 0; n >>= 7 {
+			sub = append([]byte{byte(n&0x7f) | 0x80}, sub...)
+		}
+		b = append(b, sub...)
+	}
+	return berTLV(berOID, b)
+}
+
+var errBER = errors.New("malformed BER")
+
+// berRead splits the first TLV off b.
+func berRead(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errBER
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || len(b) < size {
+			return 0, nil, nil, errBER
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < n {
+		return 0, nil, nil, errBER
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+func berReadInt(b []byte) (int64, []byte, error) {
+	tag, content, rest, err := berRead(b)
+	if err != nil || tag != berInteger || len(content) == 0 || len(content) > 8 {
+		return 0, nil, errBER
+	}
+	v := int64(int8(content[0]))
+	for _, c := range content[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, rest, nil
+}
+
+func berReadOID(b []byte) ([]uint32, []byte, error) {
+	tag, content, rest, err := berRead(b)
+	if err != nil || tag != berOID || len(content) == 0 {
+		return nil, nil, errBER
+	}
+	var subs []uint32
+	var n uint32
+	for _, c := range content {
+		n = n<<7 | uint32(c&0x7f)
+		if c&0x80 == 0 {
+			subs = append(subs, n)
+			n = 0
+		}
+	}
+	if len(subs) == 0 {
+		return nil, nil, errBER
+	}
+	// The first subidentifier is 40 times the first arc, 0 to 2, plus the
+	// second, which is only unbounded under 2.
+	first, second := subs[0]/40, subs[0]%40
+	if first > 2 {
+		first, second = 2, subs[0]-80
+	}
+	return append([]uint32{first, second}, subs[1:]...), rest, nil
+}
+
+// snmpRequest is a decoded request message.
+type snmpRequest struct {
+	version   int64
+	community string
+	pdu       byte
+	id        int64
+	// nonRepeaters and maxRepetitions of a GetBulk, which sends them in
+	// place of the error status and index.
+	nonRepeaters, maxRepetitions int64
+	oids                         [][]uint32
+}
+
+func parseSNMPRequest(b []byte) (*snmpRequest, error) {
+	tag, msg, _, err := berRead(b)
+	if err != nil || tag != berSequence {
+		return nil, errBER
+	}
+	req := &snmpRequest{}
+	if req.version, msg, err = berReadInt(msg); err != nil {
+		return nil, err
+	}
+	tag, community, msg, err := berRead(msg)
+	if err != nil || tag != berOctetString {
+		return nil, errBER
+	}
+	req.community = string(community)
+	req.pdu, msg, _, err = berRead(msg)
+	if err != nil {
+		return nil, err
+	}
+	if req.id, msg, err = berReadInt(msg); err != nil {
+		return nil, err
+	}
+	if req.nonRepeaters, msg, err = berReadInt(msg); err != nil {
+		return nil, err
+	}
+	if req.maxRepetitions, msg, err = berReadInt(msg); err != nil {
+		return nil, err
+	}
+	tag, vbs, _, err := berRead(msg)
+	if err != nil || tag != berSequence {
+		return nil, errBER
+	}
+	for len(vbs) != 0 {
+		var vb []byte
+		if tag, vb, vbs, err = berRead(vbs); err != nil || tag != berSequence {
+			return nil, errBER
+		}
+		oid, _, err := berReadOID(vb)
+		if err != nil {
+			return nil, err
+		}
+		req.oids = append(req.oids, oid)
+	}
+	return req, nil
+}
+
+func snmpResponse(req *snmpRequest, status, index int, vars []snmpVar) []byte {
+	var vbs []byte
+	for _, v := range vars {
+		vbs = append(vbs, berTLV(berSequence, berOIDValue(v.oid), v.value)...)
+	}
+	return berTLV(berSequence,
+		berInt(req.version),
+		berTLV(berOctetString, []byte(req.community)),
+		berTLV(pduResponse,
+			berInt(req.id),
+			berInt(int64(status)),
+			berInt(int64(index)),
+			berTLV(berSequence, vbs)))
+}
+
+// snmpMIB returns the agent's objects in OID order. Rigs are numbered from
+// 1 in address order, GPUs from 1 in the miner's order; the numbers change
+// when rigs are added or removed.
+func (c *ClaymoreStatsCollector) snmpMIB(base []uint32, conf *expConf, now time.Time) []snmpVar {
+	rigs := append([]string(nil), conf.Dial_Addr...)
+	sort.Strings(rigs)
+	latest, _ := c.snapshot()
+
+	var vars []snmpVar
+	add := func(value []byte, sub ...uint32) {
+		vars = append(vars, snmpVar{oid: oidAppend(base, sub...), value: value})
+	}
+	// rigTable, base.1.1.column.rig
+	rigColumns := []func(addr string, s historySample, ok bool) []byte{
+		func(addr string, s historySample, ok bool) []byte { return berTLV(berOctetString, []byte(addr)) },
+		func(addr string, s historySample, ok bool) []byte { return berInt(int64(boolValue(c.isUp(addr, now)))) },
+		func(addr string, s historySample, ok bool) []byte { return berGauge(berGauge32, s.Uptime) },
+		func(addr string, s historySample, ok bool) []byte { return berGauge(berGauge32, s.TotalRate) },
+		func(addr string, s historySample, ok bool) []byte { return berGauge(berCounter32, s.EthFound) },
+		func(addr string, s historySample, ok bool) []byte { return berGauge(berCounter32, s.EthReject) },
+		func(addr string, s historySample, ok bool) []byte { return berInt(int64(len(s.GPUs))) },
+		func(addr string, s historySample, ok bool) []byte {
+			if !ok {
+				return berGauge(berGauge32, 0)
+			}
+			return berGauge(berGauge32, now.Sub(s.Time).Seconds())
+		},
+	}
+	for col, value := range rigColumns {
+		for i, addr := range rigs {
+			s, ok := latest[addr]
+			add(value(addr, s, ok), 1, 1, uint32(col+1), uint32(i+1))
+		}
+	}
+	// gpuTable, base.2.1.column.rig.gpu
+	gpuColumns := []func(g historyGPUSample) []byte{
+		func(g historyGPUSample) []byte { return berTLV(berOctetString, []byte(g.Name)) },
+		func(g historyGPUSample) []byte { return berGauge(berGauge32, g.HashRate) },
+		func(g historyGPUSample) []byte { return berInt(int64(g.Temp)) },
+		func(g historyGPUSample) []byte { return berGauge(berGauge32, g.FanSpeed) },
+	}
+	for col, value := range gpuColumns {
+		for i, addr := range rigs {
+			for j, g := range latest[addr].GPUs {
+				add(value(g), 2, 1, uint32(col+1), uint32(i+1), uint32(j+1))
+			}
+		}
+	}
+	return vars
+}
+
+// isUp reports whether the rig's last scrape got a usable reply that isn't
+// stale, like claymore_up. On HA standby no rig is.
+func (c *ClaymoreStatsCollector) isUp(addr string, now time.Time) bool {
+	c.mu.Lock()
+	s, ok := c.cache[addr]
+	c.mu.Unlock()
+	return ok && s.ok && isLeader() && !c.stale(addr, s, now)
+}
+
+// snmpAnswer answers req from the objects in vars.
+func snmpAnswer(req *snmpRequest, vars []snmpVar) []byte {
+	get := func(oid []uint32) (snmpVar, bool) {
+		i := sort.Search(len(vars), func(i int) bool { return compareOID(vars[i].oid, oid) >= 0 })
+		if i < len(vars) && compareOID(vars[i].oid, oid) == 0 {
+			return vars[i], true
+		}
+		return snmpVar{}, false
+	}
+	next := func(oid []uint32) (snmpVar, bool) {
+		i := sort.Search(len(vars), func(i int) bool { return compareOID(vars[i].oid, oid) > 0 })
+		if i < len(vars) {
+			return vars[i], true
+		}
+		return snmpVar{}, false
+	}
+
+	var out []snmpVar
+	switch req.pdu {
+	case pduGetRequest, pduGetNext:
+		for i, oid := range req.oids {
+			find := get
+			if req.pdu == pduGetNext {
+				find = next
+			}
+			v, ok := find(oid)
+			switch {
+			case ok:
+				out = append(out, v)
+			case req.version == snmpVersion1:
+				return snmpResponse(req, snmpNoSuchName, i+1, varsOf(req.oids))
+			case req.pdu == pduGetNext:
+				out = append(out, snmpVar{oid: oid, value: []byte{berEndOfMibView, 0}})
+			default:
+				out = append(out, snmpVar{oid: oid, value: []byte{berNoSuchObject, 0}})
+			}
+		}
+	case pduGetBulk:
+		nonRep := int(req.nonRepeaters)
+		if nonRep < 0 {
+			nonRep = 0
+		}
+		if nonRep > len(req.oids) {
+			nonRep = len(req.oids)
+		}
+		reps := int(req.maxRepetitions)
+		if reps > 50 {
+			reps = 50
+		}
+		for _, oid := range req.oids[:nonRep] {
+			v, ok := next(oid)
+			if !ok {
+				v = snmpVar{oid: oid, value: []byte{berEndOfMibView, 0}}
+			}
+			out = append(out, v)
+		}
+		cursors := append([][]uint32(nil), req.oids[nonRep:]...)
+		for r := 0; r < reps && len(cursors) != 0; r++ {
+			done := true
+			for i, oid := range cursors {
+				v, ok := next(oid)
+				if !ok {
+					v = snmpVar{oid: oid, value: []byte{berEndOfMibView, 0}}
+				} else {
+					done = false
+				}
+				out = append(out, v)
+				cursors[i] = v.oid
+			}
+			if done {
+				break
+			}
+		}
+	case pduSetRequest:
+		status := snmpNotWritable
+		if req.version == snmpVersion1 {
+			status = snmpReadOnly
+		}
+		return snmpResponse(req, status, 1, varsOf(req.oids))
+	default:
+		return nil
+	}
+	return snmpResponse(req, 0, 0, out)
+}
+
+// varsOf echoes the requested OIDs with null values, for error responses.
+func varsOf(oids [][]uint32) []snmpVar {
+	vars := make([]snmpVar, len(oids))
+	for i, oid := range oids {
+		vars[i] = snmpVar{oid: oid, value: []byte{berNull, 0}}
+	}
+	return vars
+}
+
+// serveSNMP answers SNMP requests on the UDP address addr. Requests with
+// another community are dropped, as agents do.
+func serveSNMP(addr, community, baseOID string, c *ClaymoreStatsCollector) error {
+	base, err := parseOID(baseOID)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		req, err := parseSNMPRequest(buf[:n])
+		if err != nil {
+			log.Printf("Bad SNMP request from %s: %v", from, err)
+			continue
+		}
+		if req.community != community || (req.version != snmpVersion1 && req.version != snmpVersion2c) {
+			continue
+		}
+		if req.version == snmpVersion1 && req.pdu == pduGetBulk {
+			continue
+		}
+		now := time.Now()
+		if resp := snmpAnswer(req, c.snmpMIB(base, currentConf(), now)); resp != nil {
+			conn.WriteTo(resp, from)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Requests as net-snmp's tools send them, community "public".
+const (
+	// snmpget -v2c -c public agent 1.3.6.1.2.1.1.1.0
+	snmpGetV2c = "302902010104067075626c6963" + "a01c" + "02041a2b3c4d" + "020100" + "020100" +
+		"300e" + "300c" + "06082b06010201010100" + "0500"
+	// snmpgetnext -v1 -c public agent 1.3.6.1.4.1.32473.1
+	snmpGetNextV1 = "302702010004067075626c6963" + "a11a" + "020105" + "020100" + "020100" +
+		"300f" + "300d" + "06092b0601040181fd5901" + "0500"
+	// snmpbulkwalk -v2c -c public -Cn0 -Cr10 agent 1.3.6.1.4.1.32473.1
+	snmpGetBulkV2c = "302802010104067075626c6963" + "a51b" + "020204d2" + "020100" + "02010a" +
+		"300f" + "300d" + "06092b0601040181fd5901" + "0500"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustOID(t *testing.T, s string) []uint32 {
+	t.Helper()
+	oid, err := parseOID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oid
+}
+
+func TestParseSNMPRequest(t *testing.T) {
+	tests := []struct {
+		name                         string
+		packet                       string
+		version                      int64
+		pdu                          byte
+		id                           int64
+		nonRepeaters, maxRepetitions int64
+		oid                          string
+	}{
+		{"get v2c", snmpGetV2c, snmpVersion2c, pduGetRequest, 0x1a2b3c4d, 0, 0, "1.3.6.1.2.1.1.1.0"},
+		{"getnext v1", snmpGetNextV1, snmpVersion1, pduGetNext, 5, 0, 0, "1.3.6.1.4.1.32473.1"},
+		{"getbulk v2c", snmpGetBulkV2c, snmpVersion2c, pduGetBulk, 1234, 0, 10, "1.3.6.1.4.1.32473.1"},
+	}
+	for _, tt := range tests {
+		req, err := parseSNMPRequest(mustHex(t, tt.packet))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if req.version != tt.version || req.community != "public" || req.pdu != tt.pdu || req.id != tt.id {
+			t.Errorf("%s: got version %d community %q pdu %#x id %d", tt.name, req.version, req.community, req.pdu, req.id)
+		}
+		if req.nonRepeaters != tt.nonRepeaters || req.maxRepetitions != tt.maxRepetitions {
+			t.Errorf("%s: got non-repeaters %d, max-repetitions %d", tt.name, req.nonRepeaters, req.maxRepetitions)
+		}
+		if len(req.oids) != 1 || compareOID(req.oids[0], mustOID(t, tt.oid)) != 0 {
+			t.Errorf("%s: got OIDs %v, want %s", tt.name, req.oids, tt.oid)
+		}
+	}
+
+	// Truncating a request anywhere must fail cleanly.
+	packet := mustHex(t, snmpGetV2c)
+	for n := 0; n < len(packet); n++ {
+		if _, err := parseSNMPRequest(packet[:n]); err == nil {
+			t.Errorf("request truncated to %d bytes parsed", n)
+		}
+	}
+}
+
+func TestSNMPAnswerGet(t *testing.T) {
+	req, err := parseSNMPRequest(mustHex(t, snmpGetV2c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := []snmpVar{{oid: mustOID(t, "1.3.6.1.2.1.1.1.0"), value: berTLV(berOctetString, []byte("claymore"))}}
+	// What snmpget accepts as the reply: the same version, community and
+	// request id, no error, the varbind with an OCTET STRING.
+	want := "303102010104067075626c6963" + "a224" + "02041a2b3c4d" + "020100" + "020100" +
+		"3016" + "3014" + "06082b06010201010100" + "0408" + hex.EncodeToString([]byte("claymore"))
+	if got := hex.EncodeToString(snmpAnswer(req, vars)); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestBER(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"zero", berInt(0), "020100"},
+		{"127", berInt(127), "02017f"},
+		{"128 needs a sign byte", berInt(128), "02020080"},
+		{"negative", berInt(-129), "0202ff7f"},
+		{"gauge with high bit", berUint(berGauge32, 0x80000000), "42050080000000"},
+		{"counter", berUint(berCounter32, 300), "4102012c"},
+		{"gauge clamped", berGauge(berGauge32, 1e12), "420500ffffffff"},
+		{"gauge negative", berGauge(berGauge32, -1), "420100"},
+		{"long length", berTLV(berOctetString, make([]byte, 200))[:3], "0481c8"},
+		{"enterprise 32473", berOIDValue([]uint32{1, 3, 6, 1, 4, 1, 32473, 1}), "06092b0601040181fd5901"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"1.3.6.1.4.1.32473.1.2.1.5.3", "1.3.6.1.4.1.4294967295", "2.999.1"} {
+		oid := mustOID(t, s)
+		got, rest, err := berReadOID(berOIDValue(oid))
+		if err != nil || len(rest) != 0 || compareOID(got, oid) != 0 {
+			t.Errorf("OID %s: read back %v, %v", s, got, err)
+		}
+	}
+	for _, v := range []int64{0, 1, -1, 127, 128, -128, -129, 1 << 31, -(1 << 40)} {
+		got, rest, err := berReadInt(berInt(v))
+		if err != nil || len(rest) != 0 || got != v {
+			t.Errorf("integer %d: read back %d, %v", v, got, err)
+		}
+	}
+	content := bytes.Repeat([]byte{0xaa}, 300)
+	if tag, got, rest, err := berRead(berTLV(berOctetString, content)); err != nil || tag != berOctetString || !bytes.Equal(got, content) || len(rest) != 0 {
+		t.Errorf("300 byte OCTET STRING: read back %d bytes, %v", len(got), err)
+	}
+}
+
+func TestCompareOID(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.3.6.1", "1.3.6.1", 0},
+		{"1.3.6.1", "1.3.6.1.0", -1},
+		{"1.3.6.1.2", "1.3.6.1.10", -1},
+		{"1.3.6.1.10", "1.3.6.1.9.9", 1},
+	}
+	for _, tt := range tests {
+		if got := compareOID(mustOID(t, tt.a), mustOID(t, tt.b)); got != tt.want {
+			t.Errorf("compareOID(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// walkVars is a MIB view whose numeric order differs from the order of its
+// dotted strings, as with more than 9 rigs or GPUs.
+func walkVars(t *testing.T) ([]snmpVar, []string) {
+	want := []string{
+		"1.3.6.1.4.1.32473.1.1.0",
+		"1.3.6.1.4.1.32473.1.2.1.2.1",
+		"1.3.6.1.4.1.32473.1.2.1.2.2",
+		"1.3.6.1.4.1.32473.1.2.1.2.10",
+		"1.3.6.1.4.1.32473.1.2.1.3.1",
+		"1.3.6.1.4.1.32473.1.3.1.2.1.1",
+		"1.3.6.1.4.1.32473.1.3.1.2.1.2",
+		"1.3.6.1.4.1.32473.1.3.1.2.10.1",
+	}
+	shuffled := []int{5, 0, 7, 3, 1, 6, 4, 2}
+	vars := make([]snmpVar, len(want))
+	for i, j := range shuffled {
+		vars[i] = snmpVar{oid: mustOID(t, want[j]), value: berInt(int64(j))}
+	}
+	sort.Slice(vars, func(i, j int) bool { return compareOID(vars[i].oid, vars[j].oid) < 0 })
+	return vars, want
+}
+
+// snmpResponseVars decodes the varbinds of a response.
+func snmpResponseVars(t *testing.T, resp []byte) (status int64, oids []string, values [][]byte) {
+	t.Helper()
+	_, msg, _, err := berRead(resp)
+	if err == nil {
+		_, msg, err = berReadInt(msg) // version
+	}
+	if err == nil {
+		_, _, msg, err = berRead(msg) // community
+	}
+	var pdu []byte
+	if err == nil {
+		_, pdu, _, err = berRead(msg)
+	}
+	if err == nil {
+		_, pdu, err = berReadInt(pdu) // request id
+	}
+	if err == nil {
+		status, pdu, err = berReadInt(pdu)
+	}
+	if err == nil {
+		_, pdu, err = berReadInt(pdu) // error index
+	}
+	var vbs []byte
+	if err == nil {
+		_, vbs, _, err = berRead(pdu)
+	}
+	for err == nil && len(vbs) != 0 {
+		var vb []byte
+		if _, vb, vbs, err = berRead(vbs); err != nil {
+			break
+		}
+		var oid []uint32
+		if oid, vb, err = berReadOID(vb); err != nil {
+			break
+		}
+		parts := make([]string, len(oid))
+		for i, n := range oid {
+			parts[i] = strconv.FormatUint(uint64(n), 10)
+		}
+		oids = append(oids, strings.Join(parts, "."))
+		values = append(values, vb)
+	}
+	if err != nil {
+		t.Fatalf("decoding response %x: %v", resp, err)
+	}
+	return status, oids, values
+}
+
+func TestSNMPGetNextWalk(t *testing.T) {
+	vars, want := walkVars(t)
+	base := mustOID(t, "1.3.6.1.4.1.32473.1")
+	req := &snmpRequest{version: snmpVersion2c, community: "public", pdu: pduGetNext, id: 1}
+
+	var walked []string
+	cursor := base
+	for i := 0; i <= len(want); i++ {
+		req.oids = [][]uint32{cursor}
+		_, oids, values := snmpResponseVars(t, snmpAnswer(req, vars))
+		if len(oids) != 1 {
+			t.Fatalf("got %d varbinds", len(oids))
+		}
+		if bytes.Equal(values[0], []byte{berEndOfMibView, 0}) {
+			break
+		}
+		walked = append(walked, oids[0])
+		cursor = mustOID(t, oids[0])
+	}
+	if strings.Join(walked, " ") != strings.Join(want, " ") {
+		t.Errorf("walk:\n got %v\nwant %v", walked, want)
+	}
+
+	// SNMPv1 has no endOfMibView, the end is noSuchName.
+	req.version, req.oids = snmpVersion1, [][]uint32{mustOID(t, want[len(want)-1])}
+	if status, _, _ := snmpResponseVars(t, snmpAnswer(req, vars)); status != snmpNoSuchName {
+		t.Errorf("v1 past the end: status %d, want noSuchName", status)
+	}
+}
+
+func TestSNMPGetBulkWalk(t *testing.T) {
+	vars, want := walkVars(t)
+	req, err := parseSNMPRequest(mustHex(t, snmpGetBulkV2c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, oids, values := snmpResponseVars(t, snmpAnswer(req, vars))
+	// Ten repetitions walk all eight objects and stop at the end of the
+	// view.
+	if len(oids) != len(want)+1 {
+		t.Fatalf("got %d varbinds, want %d: %v", len(oids), len(want)+1, oids)
+	}
+	if strings.Join(oids[:len(want)], " ") != strings.Join(want, " ") {
+		t.Errorf("bulk walk:\n got %v\nwant %v", oids[:len(want)], want)
+	}
+	if !bytes.Equal(values[len(want)], []byte{berEndOfMibView, 0}) {
+		t.Errorf("last varbind %x, want endOfMibView", values[len(want)])
+	}
+}
@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// statsdMaxPacket keeps datagrams below a typical MTU.
+const statsdMaxPacket = 1400
+
+// statsdEmitter pushes every poll's readings to a statsd server as gauges.
+// Plain statsd has no tags, so the rig and GPU go into the metric name;
+// DogStatsD gets them as rig: and gpu: tags.
+type statsdEmitter struct {
+	conn   net.Conn
+	prefix string
+	dog    bool
+}
+
+func newStatsdEmitter(addr, prefix string, dog bool) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdEmitter{conn: conn, prefix: prefix, dog: dog}, nil
+}
+
+func (e *statsdEmitter) String() string { return "statsd" }
+
+// statsdName makes s safe as a statsd name component. Dots would split a
+// rig's address into levels of the name.
+var statsdName = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_").Replace
+
+// statsdTag makes s safe as a DogStatsD tag value, which may hold dots and
+// colons.
+var statsdTag = strings.NewReplacer("|", "_", "@", "_", "#", "_", ",", "_", "\n", "_").Replace
+
+// line formats one gauge of the rig, and of the GPU if gpu isn't empty.
+func (e *statsdEmitter) line(name string, value float64, rig, gpu string) string {
+	v := strconv.FormatFloat(value, 'f', -1, 64)
+	if e.dog {
+		tags := "rig:" + statsdTag(rig)
+		if len(gpu) != 0 {
+			name = "gpu." + name
+			tags += ",gpu:" + statsdTag(gpu)
+		}
+		return fmt.Sprintf("%s.%s:%s|g|#%s", e.prefix, name, v, tags)
+	}
+	path := e.prefix + ".rig." + statsdName(rig)
+	if len(gpu) != 0 {
+		path += ".gpu." + statsdName(gpu)
+	}
+	return fmt.Sprintf("%s.%s:%s|g", path, name, v)
+}
+
+// emit sends the rig's up state and, if it is up, its latest sample.
+// Hashrates are in H/s and uptime in seconds, as in the Prometheus metrics.
+func (e *statsdEmitter) emit(rig string, up bool, s historySample) error {
+	lines := []string{e.line("up", boolValue(up), rig, "")}
+	if up {
+		lines = append(lines,
+			e.line("uptime_seconds", s.Uptime*60, rig, ""),
+			e.line("hashrate", s.TotalRate*1000, rig, ""),
+			e.line("shares", s.EthFound, rig, ""),
+			e.line("shares_rejected", s.EthReject, rig, ""))
+		for _, g := range s.GPUs {
+			lines = append(lines,
+				e.line("hashrate", g.HashRate*1000, rig, g.Name),
+				e.line("temperature_celsius", g.Temp, rig, g.Name),
+				e.line("fan_ratio", g.FanSpeed/100, rig, g.Name))
+		}
+	}
+
+	var packet bytes.Buffer
+	for _, l := range lines {
+		if packet.Len() != 0 && packet.Len()+1+len(l) > statsdMaxPacket {
+			if _, err := e.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() != 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(l)
+	}
+	_, err := e.conn.Write(packet.Bytes())
+	return err
+}
@@ -0,0 +1,87 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// incident is something that went wrong on a rig, for the summary.
+type incident struct {
+	Time time.Time `json:"time"`
+	Rig  string    `json:"rig"`
+	GPU  string    `json:"gpu,omitempty"`
+	// Kind is rig_down, gpu_crash or gpu_overtemp.
+	Kind string `json:"kind"`
+}
+
+// noteIncident records the farm's latest incident. c.mu must be held.
+func (c *ClaymoreStatsCollector) noteIncident(rig, gpu, kind string) {
+	c.lastIncident = &incident{Time: time.Now(), Rig: rig, GPU: gpu, Kind: kind}
+}
+
+type gpuTemp struct {
+	Rig  string  `json:"rig"`
+	GPU  string  `json:"gpu"`
+	Temp float64 `json:"temp"`
+}
+
+type rigSummary struct {
+	Rig      string  `json:"rig"`
+	Up       bool    `json:"up"`
+	Hashrate float64 `json:"hashrate"`
+	MaxTemp  float64 `json:"max_temp"`
+}
+
+// farmSummary is the /api/v1/summary document. Hashrates are in H/s.
+type farmSummary struct {
+	Time         time.Time    `json:"time"`
+	RigsUp       int          `json:"rigs_up"`
+	RigsTotal    int          `json:"rigs_total"`
+	Hashrate     float64      `json:"hashrate"`
+	WorstGPU     *gpuTemp     `json:"worst_gpu,omitempty"`
+	LastIncident *incident    `json:"last_incident,omitempty"`
+	Rigs         []rigSummary `json:"rigs"`
+}
+
+// summary sums up the latest scrape of every configured rig. Rigs that are
+// down don't add to the hashrate or the temperatures.
+func (c *ClaymoreStatsCollector) summary(conf *expConf, now time.Time) farmSummary {
+	latest, _ := c.snapshot()
+	doc := farmSummary{Time: now, RigsTotal: len(conf.Dial_Addr), Rigs: []rigSummary{}}
+	for _, addr := range conf.Dial_Addr {
+		rs := rigSummary{Rig: addr, Up: c.isUp(addr, now)}
+		if s, ok := latest[addr]; ok && rs.Up {
+			doc.RigsUp++
+			rs.Hashrate = s.TotalRate * 1000
+			doc.Hashrate += rs.Hashrate
+			for _, g := range s.GPUs {
+				if g.Temp > rs.MaxTemp {
+					rs.MaxTemp = g.Temp
+				}
+				if doc.WorstGPU == nil || g.Temp > doc.WorstGPU.Temp {
+					doc.WorstGPU = &gpuTemp{Rig: addr, GPU: g.Name, Temp: g.Temp}
+				}
+			}
+		}
+		doc.Rigs = append(doc.Rigs, rs)
+	}
+
+	c.mu.Lock()
+	if c.lastIncident != nil {
+		last := *c.lastIncident
+		doc.LastIncident = &last
+	}
+	c.mu.Unlock()
+	return doc
+}
+
+// summaryHandler serves /api/v1/summary, a small document for status
+// pages and desk displays. Any origin may fetch it.
+func summaryHandler(c *ClaymoreStatsCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(c.summary(currentConf(), time.Now()))
+	}
+}
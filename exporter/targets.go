@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// loggedMerges remembers merges already reported, readConf runs on every
+// reload and would otherwise repeat them.
+var loggedMerges = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+func logMerge(dup, kept, why string) {
+	msg := dup + " -> " + kept + " (" + why + ")"
+
+	loggedMerges.Lock()
+	defer loggedMerges.Unlock()
+	if loggedMerges.seen[msg] {
+		return
+	}
+	loggedMerges.seen[msg] = true
+	log.Printf("Merged duplicate target %s into %s: %s", dup, kept, why)
+}
+
+// dedupTargets drops empty and repeated targets, including a hostname and
+// an IP that point at the same miner, keeping the first spelling. Two
+// entries for one miner would export duplicate series and fail the whole
+// scrape. Targets on the same host with different ports are separate miner
+// instances and are kept.
+func dedupTargets(addrs []string, defaultPort string) []string {
+	var out []string
+	seen := make(map[string]string) // target or resolved ip:port -> kept target
+
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if len(addr) == 0 {
+			continue
+		}
+		if kept, ok := seen[addr]; ok {
+			logMerge(addr, kept, "listed twice")
+			continue
+		}
+
+		host, port := splitTarget(addr, defaultPort)
+		var ips []string
+		for _, ip := range hosts.lookupAll(host) {
+			ips = append(ips, net.JoinHostPort(ip, port))
+		}
+		merged := false
+		for _, ip := range ips {
+			if kept, ok := seen[ip]; ok {
+				logMerge(addr, kept, "both point at "+ip)
+				merged = true
+				break
+			}
+		}
+		if merged {
+			continue
+		}
+
+		seen[addr] = addr
+		for _, ip := range ips {
+			seen[ip] = addr
+		}
+		out = append(out, addr)
+	}
+	return out
+}
+
+// targetStore holds the targets added and removed through the targets API
+// on top of CLAYMORE_DIAL_ADDR and CLAYMORE_TARGETS_FILE. With persist set,
+// changes are also written back to the targets file so they survive a
+// restart.
+type targetStore struct {
+	mu      sync.Mutex
+	added   []string
+	removed map[string]bool
+	persist bool
+}
+
+var runtimeTargets = &targetStore{removed: make(map[string]bool)}
+
+// readTargetsFile returns the targets listed in path, one per line. Blank
+// lines and lines starting with # are skipped.
+func readTargetsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, nil
+}
+
+func writeTargetsFile(path string, targets []string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(targets, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// apply returns addrs with the runtime changes applied.
+func (s *targetStore) apply(addrs []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []string
+	for _, addr := range append(addrs, s.added...) {
+		if !s.removed[strings.TrimSpace(addr)] {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// add adds a target. With persist set and a targets file configured it is
+// written there, otherwise it only lives until the exporter restarts.
+func (s *targetStore) add(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.removed, target)
+	if file := os.Getenv("CLAYMORE_TARGETS_FILE"); s.persist && len(file) != 0 {
+		targets, err := readTargetsFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, t := range targets {
+			if t == target {
+				return nil
+			}
+		}
+		return writeTargetsFile(file, append(targets, target))
+	}
+
+	for _, t := range s.added {
+		if t == target {
+			return nil
+		}
+	}
+	s.added = append(s.added, target)
+	return nil
+}
+
+// remove removes a target. It is dropped from the targets file when
+// persisting; targets from CLAYMORE_DIAL_ADDR are only hidden until the
+// exporter restarts.
+func (s *targetStore) remove(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []string
+	for _, t := range s.added {
+		if t != target {
+			added = append(added, t)
+		}
+	}
+	s.added = added
+
+	if file := os.Getenv("CLAYMORE_TARGETS_FILE"); s.persist && len(file) != 0 {
+		targets, err := readTargetsFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var kept []string
+		for _, t := range targets {
+			if t != target {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) != len(targets) {
+			if err := writeTargetsFile(file, kept); err != nil {
+				return err
+			}
+		}
+	}
+	s.removed[target] = true
+	return nil
+}
@@ -0,0 +1,43 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// writeTextfile writes the metrics of g to path once per interval,
+// for node_exporter's textfile collector. The file is replaced atomically so
+// node_exporter never reads a partial one.
+func writeTextfile(path string, interval time.Duration, g prometheus.Gatherer) {
+	for {
+		if err := prometheus.WriteToTextfile(path, g); err != nil {
+			log.Printf("Writing %s: %v", path, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// dryRun collects g once and writes the metrics to out in the text format,
+// and the number of series of each metric to summary. Collection errors,
+// like duplicate series, are returned so CI jobs fail on them.
+func dryRun(out, summary io.Writer, g prometheus.Gatherer) error {
+	families, err := g.Gather()
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(out, mf); err != nil {
+			return err
+		}
+	}
+
+	total := 0
+	for _, mf := range families {
+		fmt.Fprintf(summary, "%6d %s\n", len(mf.Metric), mf.GetName())
+		total += len(mf.Metric)
+	}
+	fmt.Fprintf(summary, "%6d series in total\n", total)
+	return err
+}
@@ -0,0 +1,47 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is a no-op until setupTracing installs a provider.
+var tracer = otel.Tracer("github.com/murat1985/claymore_exporter")
+
+// setupTracing exports spans over OTLP/HTTP to endpoint (host:port). The
+// returned function flushes the spans still buffered.
+func setupTracing(endpoint string, insecure bool) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("claymore_exporter"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// phaseSpan records a phase that was timed rather than traced as it ran,
+// like the dial and rpc of a miner call.
+func phaseSpan(ctx context.Context, name string, start time.Time, d time.Duration) {
+	_, span := tracer.Start(ctx, name, trace.WithTimestamp(start))
+	span.End(trace.WithTimestamp(start.Add(d)))
+}
+
+func rigAttr(addr string) trace.SpanStartEventOption {
+	return trace.WithAttributes(attribute.String("claymore.rig", addr))
+}
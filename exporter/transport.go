@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// rawReply is the loosest framing seen from EthMan-compatible miners:
+// id and error may be missing, and some send the bare result array.
+type rawReply struct {
+	Result json.RawMessage `json:"result"`
+	Error  interface{}     `json:"error"`
+}
+
+// callRaw speaks the EthMan protocol without net/rpc: it writes the request
+// JSON and reads a single reply terminated by a newline or EOF.
+func callRaw(addr string, conf *expConf, t *probeTimings) (*json.RawMessage, error) {
+	timeouts := conf.timeouts(addr)
+	start := time.Now()
+	client, err := dialMiner(context.Background(), "tcp", addr, conf, timeouts.dial)
+	t.dial = time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("dialing: %w", err)
+	}
+	defer client.Close()
+	t.remote = remoteIP(client)
+
+	start = time.Now()
+	defer func() { t.rpc = time.Since(start) }()
+	client.SetDeadline(time.Now().Add(timeouts.rpc))
+
+	req := minerCommand{ID: 0, JSONRPC: "2.0", Method: conf.Method, Psw: conf.passwordFor(addr)}
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		return nil, fmt.Errorf("sending %s: %w", conf.Method, err)
+	}
+
+	line, err := bufio.NewReader(limitConn(client)).ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+	return decodeRawReply(line)
+}
+
+func decodeRawReply(data []byte) (*json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+
+	// Bare result array.
+	if len(data) != 0 && data[0] == '[' {
+		result := json.RawMessage(data)
+		return &result, nil
+	}
+
+	var reply rawReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("decoding reply: %v", err)
+	}
+	if reply.Error != nil {
+		return nil, fmt.Errorf("miner error: %v", reply.Error)
+	}
+	if len(reply.Result) == 0 {
+		return nil, fmt.Errorf("reply has no result")
+	}
+	return &reply.Result, nil
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// callHTTP fetches the status page Claymore serves over HTTP on its API
+// port and extracts the JSON reply embedded in it. The connection is set up
+// inside the HTTP client, so its time counts towards the rpc phase; the
+// dial timeout still bounds connecting.
+func callHTTP(addr string, conf *expConf, t *probeTimings) (*json.RawMessage, error) {
+	start := time.Now()
+	defer func() { t.rpc = time.Since(start) }()
+
+	timeouts := conf.timeouts(addr)
+	client := &http.Client{
+		Timeout: timeouts.dial + timeouts.rpc,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				conn, err := dialMiner(ctx, network, addr, conf, timeouts.dial)
+				if err == nil {
+					t.remote = remoteIP(conn)
+				}
+				return conn, err
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	url := fmt.Sprintf("http://%s/", dialAddr(addr, conf.Port))
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	body, err := readLimited(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", url, err)
+	}
+	return extractEmbeddedReply(body)
+}
+
+// extractEmbeddedReply finds the {"result": [...]} object in an HTML page.
+func extractEmbeddedReply(page []byte) (*json.RawMessage, error) {
+	i := bytes.Index(page, []byte(`"result"`))
+	if i < 0 {
+		return nil, fmt.Errorf("no result in page")
+	}
+	start := bytes.LastIndexByte(page[:i], '{')
+	if start < 0 {
+		return nil, fmt.Errorf("no result object in page")
+	}
+
+	// The decoder stops after the first value, ignoring the HTML after it.
+	var reply rawReply
+	if err := json.NewDecoder(bytes.NewReader(page[start:])).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("decoding embedded reply: %v", err)
+	}
+	if len(reply.Result) == 0 {
+		return nil, fmt.Errorf("reply has no result")
+	}
+	return &reply.Result, nil
+}
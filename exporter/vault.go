@@ -0,0 +1,142 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultClient reads the exporter's secrets from a HashiCorp Vault KV
+// secret. It is configured with the usual VAULT_ADDR and VAULT_TOKEN plus
+// CLAYMORE_VAULT_PATH, e.g. secret/data/claymore for a KV v2 mount.
+//
+// Recognised keys:
+//
+//	password          miner -mpsw for all rigs
+//	password.<rig>    miner -mpsw for one rig, overriding the above
+//	control_token     bearer token of the control API
+//	redfish.<rig>     password of the rig host's BMC
+type vaultClient struct {
+	addr  string
+	token string
+	path  string
+}
+
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+func (v *vaultClient) do(method, path string) (*vaultResponse, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	vr := &vaultResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(vr); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.Join(vr.Errors, "; "))
+	}
+	return vr, nil
+}
+
+// read fetches the secret, unwrapping the extra data level of KV v2. ttl is
+// the lease duration Vault suggests re-reading after, 0 if none.
+func (v *vaultClient) read() (map[string]string, time.Duration, error) {
+	vr, err := v.do(http.MethodGet, v.path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data := vr.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+
+	out := make(map[string]string)
+	for k, val := range data {
+		if s, ok := val.(string); ok {
+			out[k] = s
+		}
+	}
+	return out, time.Duration(vr.LeaseDuration) * time.Second, nil
+}
+
+// vaultSecrets holds the last secrets read from Vault.
+type vaultSecrets struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+// secrets is consulted by readConf; it stays empty without Vault.
+var secrets = &vaultSecrets{}
+
+func (s *vaultSecrets) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *vaultSecrets) set(data map[string]string) {
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+}
+
+// keep re-reads the secret when its lease runs out, or every refresh for
+// secrets without a lease, and renews the Vault token on the way. Errors
+// keep the previous secrets in place.
+func (v *vaultClient) keep(s *vaultSecrets, ttl, refresh time.Duration) {
+	for {
+		wait := refresh
+		if ttl > 0 && ttl < wait {
+			// Re-read a little before the lease expires.
+			wait = ttl * 9 / 10
+		}
+		time.Sleep(wait)
+
+		if _, err := v.do(http.MethodPost, "auth/token/renew-self"); err != nil {
+			log.Print("Renewing Vault token:", err)
+		}
+
+		data, newTTL, err := v.read()
+		if err != nil {
+			log.Print("Reading secrets from Vault:", err)
+			continue
+		}
+		s.set(data)
+		ttl = newTTL
+		if err := reloadConf(); err != nil {
+			log.Print("Reloading config with new secrets:", err)
+		}
+	}
+}
+
+// startVault loads the secrets once, failing hard so a misconfigured
+// exporter doesn't run without passwords, and keeps them fresh afterwards.
+func startVault(addr, token, path string, refresh time.Duration) error {
+	v := &vaultClient{addr: addr, token: token, path: path}
+	data, ttl, err := v.read()
+	if err != nil {
+		return err
+	}
+	secrets.set(data)
+	go v.keep(secrets, ttl, refresh)
+	return nil
+}
@@ -0,0 +1,118 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var walletBalanceDesc = prometheus.NewDesc(
+	"claymore_wallet_balance_coins",
+	"On-chain balance of the wallet, from the coin's node",
+	[]string{"coin", "wallet"},
+	nil)
+
+// walletBalances reads the balances of the wallets configured for each
+// coin with eth_getBalance from the coin's node, an Ethereum-style JSON-RPC
+// endpoint (geth, an ETC node, or a public RPC provider).
+type walletBalances struct {
+	mu       sync.Mutex
+	balances map[poolWallet]float64
+}
+
+var wallets = &walletBalances{balances: make(map[poolWallet]float64)}
+
+// ethBalance returns the balance of wallet in coins, at the latest block.
+func ethBalance(node, wallet string) (float64, error) {
+	req, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "eth_getBalance",
+		"params":  []string{wallet, "latest"},
+	})
+	resp, err := httpClient.Post(node, "application/json", bytes.NewReader(req))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("POST %s: %s", node, resp.Status)
+	}
+
+	var reply struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("decoding %s: %v", node, err)
+	}
+	if reply.Error != nil {
+		return 0, fmt.Errorf("eth_getBalance: %s", reply.Error.Message)
+	}
+	wei, ok := new(big.Int).SetString(strings.TrimPrefix(reply.Result, "0x"), 16)
+	if !ok {
+		return 0, fmt.Errorf("bad balance %q", reply.Result)
+	}
+	coins, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Float64()
+	return coins, nil
+}
+
+// refresh reads the balances once per interval. Errors keep a wallet's
+// previous balance; wallets no longer configured are dropped.
+func (b *walletBalances) refresh(interval time.Duration) {
+	for {
+		conf := currentConf()
+		balances := make(map[poolWallet]float64)
+		if conf.File != nil {
+			for coin, cc := range conf.File.Coins {
+				if len(cc.NodeURL) == 0 {
+					continue
+				}
+				for _, wallet := range cc.Wallets {
+					w := poolWallet{coin, wallet}
+					balance, err := ethBalance(cc.NodeURL, wallet)
+					if err != nil {
+						log.Printf("Reading %s balance of %s: %v", coin, wallet, err)
+						b.mu.Lock()
+						last, ok := b.balances[w]
+						b.mu.Unlock()
+						if !ok {
+							continue
+						}
+						balance = last
+					}
+					balances[w] = balance
+				}
+			}
+		}
+		b.mu.Lock()
+		b.balances = balances
+		b.mu.Unlock()
+		time.Sleep(interval)
+	}
+}
+
+func (b *walletBalances) Describe(ch chan<- *prometheus.Desc) {
+	ch <- walletBalanceDesc
+}
+
+func (b *walletBalances) Collect(ch chan<- prometheus.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for w, balance := range b.balances {
+		ch <- prometheus.MustNewConstMetric(walletBalanceDesc,
+			prometheus.GaugeValue,
+			balance,
+			w.coin, w.wallet)
+	}
+}
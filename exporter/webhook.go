@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookConf is a URL the poller posts state changes of rigs to, e.g. a
+// ticketing system's inbound hook.
+type webhookConf struct {
+	URL string `json:"url"`
+	// Changes limits the webhook to these changes, all of them if empty.
+	Changes []string `json:"changes"`
+	// Headers are set on the request, e.g. Authorization.
+	Headers map[string]string `json:"headers"`
+}
+
+// State changes posted to webhooks.
+const (
+	changeRigDown     = "rig_down"
+	changeRigUp       = "rig_up"
+	changeGPUAdded    = "gpu_added"
+	changeGPURemoved  = "gpu_removed"
+	changePoolChanged = "pool_changed"
+)
+
+var webhookChanges = map[string]bool{
+	changeRigDown:     true,
+	changeRigUp:       true,
+	changeGPUAdded:    true,
+	changeGPURemoved:  true,
+	changePoolChanged: true,
+}
+
+func (w webhookConf) wants(change string) bool {
+	if len(w.Changes) == 0 {
+		return true
+	}
+	for _, c := range w.Changes {
+		if c == change {
+			return true
+		}
+	}
+	return false
+}
+
+// stateChange is the JSON body of a webhook.
+type stateChange struct {
+	Change string    `json:"change"`
+	Time   time.Time `json:"time"`
+	Rig    string    `json:"rig"`
+	// GPU is the GPU added or removed, GPUs the rig's GPU count after it.
+	GPU  string `json:"gpu,omitempty"`
+	GPUs int    `json:"gpus,omitempty"`
+	// From and To are the old and new pool.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// rigState is what the webhooks compare between polls.
+type rigState struct {
+	up   bool
+	gpus map[string]bool
+	pool string
+}
+
+// webhookRetries is how often a failed webhook is tried again, with a
+// delay doubling from webhookRetryDelay.
+const (
+	webhookRetries    = 3
+	webhookRetryDelay = 5 * time.Second
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookNotifier is a poll sink posting the changes it sees to the
+// webhooks in the config file, independently of the alerting rules, which
+// fire on thresholds. It is always on with the poller so webhooks can be
+// added with a config reload.
+type webhookNotifier struct {
+	mu    sync.Mutex
+	rigs  map[string]rigState
+	queue chan stateChange
+}
+
+func newWebhookNotifier() *webhookNotifier {
+	w := &webhookNotifier{rigs: make(map[string]rigState), queue: make(chan stateChange, eventQueueSize)}
+	go w.run()
+	return w
+}
+
+func (w *webhookNotifier) String() string { return "webhooks" }
+
+// emit compares the rig's state with the last poll's. Nothing is posted
+// for the first poll of a rig that is up; one that is down is reported.
+// GPUs and pool are only compared while the rig is up.
+func (w *webhookNotifier) emit(rig string, up bool, s historySample) error {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	was, seen := w.rigs[rig]
+	st := rigState{up: up, gpus: was.gpus, pool: was.pool}
+	if up {
+		st.gpus = make(map[string]bool, len(s.GPUs))
+		for _, gpu := range s.GPUs {
+			st.gpus[gpu.Name] = true
+		}
+		st.pool = s.Pool
+	}
+	w.rigs[rig] = st
+
+	switch {
+	case (!seen || was.up) && !up:
+		w.send(stateChange{Change: changeRigDown, Time: now, Rig: rig})
+	case seen && !was.up && up:
+		w.send(stateChange{Change: changeRigUp, Time: now, Rig: rig})
+	}
+	// A rig seen down first has nothing to compare with yet.
+	if !up || was.gpus == nil {
+		return nil
+	}
+	for _, gpu := range s.GPUs {
+		if !was.gpus[gpu.Name] {
+			w.send(stateChange{Change: changeGPUAdded, Time: now, Rig: rig, GPU: gpu.Name, GPUs: len(st.gpus)})
+		}
+	}
+	for gpu := range was.gpus {
+		if !st.gpus[gpu] {
+			w.send(stateChange{Change: changeGPURemoved, Time: now, Rig: rig, GPU: gpu, GPUs: len(st.gpus)})
+		}
+	}
+	if st.pool != was.pool {
+		w.send(stateChange{Change: changePoolChanged, Time: now, Rig: rig, From: was.pool, To: st.pool})
+	}
+	return nil
+}
+
+// send queues the change, dropping it if the queue is full, and publishes
+// it as an event. Rigs in maintenance and silenced changes post nothing.
+func (w *webhookNotifier) send(c stateChange) {
+	if suppressed(c.Rig, c.Change) {
+		return
+	}
+	events.send(event{Type: "change", Time: c.Time, Rig: c.Rig, Change: c.Change, GPU: c.GPU, GPUs: c.GPUs, From: c.From, To: c.To})
+	select {
+	case w.queue <- c:
+	default:
+		log.Printf("Webhook queue full, dropping %s of %s", c.Change, c.Rig)
+	}
+}
+
+func (w *webhookNotifier) run() {
+	for c := range w.queue {
+		conf := currentConf()
+		if conf.File == nil {
+			continue
+		}
+		body, _ := json.Marshal(c)
+		for _, hook := range conf.File.Webhooks {
+			if hook.wants(c.Change) {
+				go postWebhook(hook, c, body)
+			}
+		}
+	}
+}
+
+// postWebhook posts body, trying again on errors and non-2xx replies.
+func postWebhook(hook webhookConf, c stateChange, body []byte) {
+	delay := webhookRetryDelay
+	for try := 0; ; try++ {
+		err := postWebhookOnce(hook, body)
+		if err == nil {
+			return
+		}
+		if try == webhookRetries {
+			log.Printf("Webhook %s for %s of %s: %v, giving up", hook.URL, c.Change, c.Rig, err)
+			return
+		}
+		log.Printf("Webhook %s for %s of %s: %v, retrying in %v", hook.URL, c.Change, c.Rig, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func postWebhookOnce(hook webhookConf, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
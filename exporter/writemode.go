@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var apiWritableDesc = prometheus.NewDesc(
+	"claymore_api_writable",
+	"1 if the miner's API accepts management commands: positive -mport and the right password",
+	[]string{"Rig"},
+	nil)
+
+// writableRefresh is how often the collector checks a rig's API mode again.
+const writableRefresh = 10 * time.Minute
+
+// writableState is whether a rig's API was writable when last checked.
+type writableState struct {
+	writable bool
+	time     time.Time
+}
+
+// writeModes remembers the API mode of every rig, for the collector and
+// the control API.
+type writeModes struct {
+	mu   sync.Mutex
+	rigs map[string]writableState
+}
+
+var writeMode = &writeModes{rigs: make(map[string]writableState)}
+
+// probeWritable asks the miner for config.txt with miner_getfile, the only
+// management method that answers. A miner with a read-only API, or given
+// the wrong password, closes the connection without a reply; any reply,
+// even an error for a missing file, means the API is writable. An error
+// is returned only if the miner can't be reached.
+func probeWritable(addr string, conf *expConf) (bool, error) {
+	client, err := dialMiner(context.Background(), "tcp", addr, conf, 5*time.Second)
+	if err != nil {
+		return false, fmt.Errorf("dialing: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := minerCommand{ID: 0, JSONRPC: "2.0", Method: methodGetFile, Params: []string{"config.txt"}, Psw: conf.passwordFor(addr)}
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		return false, fmt.Errorf("sending %s: %v", methodGetFile, err)
+	}
+	line, _ := bufio.NewReader(client).ReadBytes('\n')
+	var reply struct {
+		ID *int `json:"id"`
+	}
+	return json.Unmarshal(line, &reply) == nil && reply.ID != nil, nil
+}
+
+// probe checks the rig's API mode now and remembers it.
+func (m *writeModes) probe(addr string, conf *expConf, now time.Time) (bool, error) {
+	writable, err := probeWritable(addr, conf)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	m.rigs[addr] = writableState{writable: writable, time: now}
+	m.mu.Unlock()
+	return writable, nil
+}
+
+// check returns the rig's API mode, probing it again if it was last
+// checked more than writableRefresh ago.
+func (m *writeModes) check(addr string, conf *expConf, now time.Time) (bool, error) {
+	m.mu.Lock()
+	st, ok := m.rigs[addr]
+	m.mu.Unlock()
+	if ok && now.Sub(st.time) < writableRefresh {
+		return st.writable, nil
+	}
+	return m.probe(addr, conf, now)
+}
+
+func apiWritableMetrics(addr string, conf *expConf, now time.Time) []prometheus.Metric {
+	writable, err := writeMode.check(addr, conf, now)
+	if err != nil {
+		return nil
+	}
+	return []prometheus.Metric{prometheus.MustNewConstMetric(apiWritableDesc,
+		prometheus.GaugeValue,
+		boolValue(writable),
+		addr)}
+}
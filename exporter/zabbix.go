@@ -0,0 +1,166 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zabbixConf maps the poller's readings to Zabbix hosts and item keys.
+type zabbixConf struct {
+	// Host is the Zabbix host name of a rig, with {rig} standing for its
+	// address and {host} for the address without port. Defaults to {host}.
+	Host string `json:"host"`
+	// Keys overrides the item key of a reading, see zabbixReadings. {gpu}
+	// stands for the GPU name. An empty key leaves the reading out.
+	Keys map[string]string `json:"keys"`
+}
+
+// zabbixReadings are the readings sent and their default item keys.
+// Hashrates are in H/s and uptime in seconds, as in the Prometheus metrics.
+var zabbixReadings = map[string]string{
+	"up":                      "claymore.up",
+	"uptime_seconds":          "claymore.uptime_seconds",
+	"hashrate":                "claymore.hashrate",
+	"shares":                  "claymore.shares",
+	"shares_rejected":         "claymore.shares_rejected",
+	"gpu_hashrate":            "claymore.gpu.hashrate[{gpu}]",
+	"gpu_temperature_celsius": "claymore.gpu.temperature_celsius[{gpu}]",
+	"gpu_fan_ratio":           "claymore.gpu.fan_ratio[{gpu}]",
+}
+
+// zabbixSender sends readings to a Zabbix server or proxy like
+// zabbix_sender, to items of type Zabbix trapper.
+type zabbixSender struct {
+	server string
+}
+
+func (z *zabbixSender) String() string { return "Zabbix" }
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// zabbixHost returns the Zabbix host name of the rig at addr.
+func (c *expConf) zabbixHost(addr string) string {
+	if host := c.rig(addr).ZabbixHost; len(host) != 0 {
+		return host
+	}
+	tmpl := "{host}"
+	if c.File != nil && c.File.Zabbix != nil && len(c.File.Zabbix.Host) != 0 {
+		tmpl = c.File.Zabbix.Host
+	}
+	host, _ := splitTarget(addr, "")
+	return strings.NewReplacer("{rig}", addr, "{host}", host).Replace(tmpl)
+}
+
+// zabbixKey returns the item key of a reading, empty to leave it out.
+func (c *expConf) zabbixKey(reading string) string {
+	if c.File != nil && c.File.Zabbix != nil {
+		if key, ok := c.File.Zabbix.Keys[reading]; ok {
+			return key
+		}
+	}
+	return zabbixReadings[reading]
+}
+
+func (z *zabbixSender) emit(rig string, up bool, s historySample) error {
+	conf := currentConf()
+	host := conf.zabbixHost(rig)
+	now := time.Now().Unix()
+
+	var items []zabbixItem
+	add := func(reading, gpu string, value float64, clock int64) {
+		key := conf.zabbixKey(reading)
+		if len(key) == 0 {
+			return
+		}
+		items = append(items, zabbixItem{
+			Host:  host,
+			Key:   strings.ReplaceAll(key, "{gpu}", gpu),
+			Value: strconv.FormatFloat(value, 'f', -1, 64),
+			Clock: clock,
+		})
+	}
+	add("up", "", boolValue(up), now)
+	if up {
+		clock := s.Time.Unix()
+		add("uptime_seconds", "", s.Uptime*60, clock)
+		add("hashrate", "", s.TotalRate*1000, clock)
+		add("shares", "", s.EthFound, clock)
+		add("shares_rejected", "", s.EthReject, clock)
+		for _, g := range s.GPUs {
+			add("gpu_hashrate", g.Name, g.HashRate*1000, clock)
+			add("gpu_temperature_celsius", g.Name, g.Temp, clock)
+			add("gpu_fan_ratio", g.Name, g.FanSpeed/100, clock)
+		}
+	}
+	return z.send(items)
+}
+
+// send delivers items in one sender data request and checks that the
+// server processed all of them.
+func (z *zabbixSender) send(items []zabbixItem) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"request": "sender data",
+		"data":    items,
+		"clock":   time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	host, port := splitTarget(z.server, "10051")
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// ZBXD, protocol flags 1, the data length as 64 bit little endian.
+	header := make([]byte, 13)
+	copy(header, "ZBXD\x01")
+	binary.LittleEndian.PutUint64(header[5:], uint64(len(body)))
+	if _, err := conn.Write(append(header, body...)); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("reading reply: %v", err)
+	}
+	if !bytes.HasPrefix(header, []byte("ZBXD")) {
+		return fmt.Errorf("reply isn't a Zabbix protocol message")
+	}
+	size := binary.LittleEndian.Uint64(header[5:])
+	if size > 1<<20 {
+		return fmt.Errorf("reply of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return fmt.Errorf("reading reply: %v", err)
+	}
+	var reply struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return fmt.Errorf("decoding reply: %v", err)
+	}
+	if reply.Response != "success" {
+		return fmt.Errorf("server answered %q: %s", reply.Response, reply.Info)
+	}
+	if !strings.Contains(reply.Info, "failed: 0;") {
+		return fmt.Errorf("not all items were accepted, check their hosts and keys: %s", reply.Info)
+	}
+	return nil
+}